@@ -0,0 +1,270 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
+)
+
+const (
+	// KindUnhealthy - the cluster became unhealthy
+	KindUnhealthy = "unhealthy"
+	// KindChanged - the cluster is still unhealthy but for a different reason
+	KindChanged = "changed"
+	// KindResolved - the cluster recovered
+	KindResolved = "resolved"
+)
+
+// Transition - a change in the cluster's health verdict, carrying the report that caused it
+type Transition struct {
+	Kind            string        `json:"kind"`
+	At              time.Time     `json:"at"`
+	Cluster         string        `json:"cluster,omitempty"`
+	PreviousHealthy bool          `json:"previous_healthy"`
+	PreviousMessage string        `json:"previous_message,omitempty"`
+	Report          health.Report `json:"report"`
+	MonitorURL      string        `json:"monitor_url,omitempty"`
+}
+
+// Notifier - delivers transitions to a single destination
+type Notifier interface {
+	// Name - the kind of notifier, such as webhook
+	Name() string
+	// Target - where the notifier delivers to, safe to log
+	Target() string
+	Notify(ctx context.Context, transition Transition) error
+}
+
+// Batcher - a notifier that can deliver several transitions at once; transitions arriving within its window are
+// collected and delivered together as a digest, a zero window delivers each transition as it comes
+type Batcher interface {
+	Notifier
+	Window() time.Duration
+	NotifyBatch(ctx context.Context, transitions []Transition) error
+}
+
+// Config - how the dispatcher retries and de-duplicates deliveries
+type Config struct {
+	MonitorURL  string
+	Instance    string
+	Retries     int
+	Backoff     time.Duration
+	Timeout     time.Duration
+	DedupWindow time.Duration
+	Store       store.Store
+}
+
+// queueLength - the transitions that may wait for delivery to a single notifier before new ones are dropped
+const queueLength = 64
+
+// Dispatcher - detects verdict transitions and delivers them to every notifier; transitions are relative to what
+// was last announced for the same cluster, so a persistent fault is announced once and a reason alternating within
+// the dedup window is not repeated
+type Dispatcher struct {
+	notifiers []Notifier
+	queues    []chan Transition
+	config    Config
+	mutex     sync.Mutex
+	announced map[string]*announcement
+	wg        sync.WaitGroup
+}
+
+// announcement - what was last announced about a single cluster
+type announcement struct {
+	healthy  bool
+	message  string
+	lastSent map[string]time.Time
+}
+
+// NewDispatcher - returns a dispatcher delivering to the given notifiers, carrying on from the alerts this instance
+// stored before it restarted when the config has a store
+func NewDispatcher(notifiers []Notifier, config Config) *Dispatcher {
+	d := &Dispatcher{
+		notifiers: notifiers,
+		config:    config,
+		announced: make(map[string]*announcement),
+	}
+	if config.Store != nil {
+		d.restore()
+	}
+	for _, notifier := range notifiers {
+		queue := make(chan Transition, queueLength)
+		d.queues = append(d.queues, queue)
+		go d.work(notifier, queue)
+	}
+	return d
+}
+
+// restore - seeds what was last announced about each cluster from the stored alerts of this instance, so that an
+// outage it was restarted during is not announced again and a recovery while it was down is still announced
+func (d *Dispatcher) restore() {
+	alerts, err := d.config.Store.Alerts(time.Time{})
+	if err != nil {
+		fmt.Printf("Could not restore the alerts already announced: %v\n", err)
+		return
+	}
+	latest := make(map[string]time.Time)
+	for _, record := range alerts {
+		if record.Instance != d.config.Instance {
+			continue
+		}
+		announced, ok := d.announced[record.Cluster]
+		if !ok {
+			announced = &announcement{lastSent: make(map[string]time.Time)}
+			d.announced[record.Cluster] = announced
+		}
+		if sent, ok := announced.lastSent[record.Message]; !ok || record.At.After(sent) {
+			announced.lastSent[record.Message] = record.At
+		}
+		if record.At.Before(latest[record.Cluster]) {
+			continue
+		}
+		latest[record.Cluster] = record.At
+		announced.healthy = record.Healthy
+		announced.message = record.Message
+	}
+}
+
+// Observe - compares a completed check with what was last announced for its cluster and delivers any transition in
+// the background, returning the transition and whether one was sent
+func (d *Dispatcher) Observe(report health.Report) (Transition, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	announced, ok := d.announced[report.Cluster]
+	if !ok {
+		announced = &announcement{healthy: true, lastSent: make(map[string]time.Time)}
+		d.announced[report.Cluster] = announced
+	}
+	transition := Transition{
+		At:              report.CheckedAt,
+		Cluster:         report.Cluster,
+		PreviousHealthy: announced.healthy,
+		PreviousMessage: announced.message,
+		Report:          report,
+		MonitorURL:      d.config.MonitorURL,
+	}
+	switch {
+	case announced.healthy && !report.Healthy:
+		transition.Kind = KindUnhealthy
+	case !announced.healthy && report.Healthy:
+		transition.Kind = KindResolved
+	case !report.Healthy && report.Message != announced.message:
+		transition.Kind = KindChanged
+		if sent, ok := announced.lastSent[report.Message]; ok && d.config.DedupWindow > 0 && transition.At.Sub(sent) < d.config.DedupWindow {
+			fmt.Printf("Not alerting %q again, already announced at %s\n", report.Message, sent)
+			return Transition{}, false
+		}
+	default:
+		return Transition{}, false
+	}
+	announced.healthy = report.Healthy
+	announced.message = report.Message
+	announced.lastSent[report.Message] = transition.At
+
+	for i, queue := range d.queues {
+		d.wg.Add(1)
+		select {
+		case queue <- transition:
+		default:
+			d.wg.Done()
+			fmt.Printf("Dropping %s alert to %s, too many alerts are waiting\n", d.notifiers[i].Name(), d.notifiers[i].Target())
+		}
+	}
+	return transition, true
+}
+
+// work - delivers the transitions queued for a notifier one at a time, so they arrive in order
+func (d *Dispatcher) work(notifier Notifier, queue chan Transition) {
+	batcher, ok := notifier.(Batcher)
+	if !ok || batcher.Window() <= 0 {
+		for transition := range queue {
+			d.deliver(notifier, []Transition{transition}, func(ctx context.Context) error {
+				return notifier.Notify(ctx, transition)
+			})
+			d.wg.Done()
+		}
+		return
+	}
+	for transition := range queue {
+		batch := collect(transition, queue, batcher.Window())
+		d.deliver(notifier, batch, func(ctx context.Context) error {
+			return batcher.NotifyBatch(ctx, batch)
+		})
+		for range batch {
+			d.wg.Done()
+		}
+	}
+}
+
+// collect - gathers the transitions queued within the window after the first
+func collect(first Transition, queue chan Transition, window time.Duration) []Transition {
+	batch := []Transition{first}
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	for {
+		select {
+		case transition := <-queue:
+			batch = append(batch, transition)
+		case <-timer.C:
+			return batch
+		}
+	}
+}
+
+// Wait - blocks until every delivery in progress has finished
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// deliver - sends transitions to a notifier, retrying with exponential backoff
+func (d *Dispatcher) deliver(notifier Notifier, transitions []Transition, send func(ctx context.Context) error) {
+	var err error
+	backoff := d.config.Backoff
+	for attempt := 0; attempt <= d.config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = d.send(send)
+		if err == nil {
+			break
+		}
+		fmt.Printf("Could not send %s alert to %s (attempt %d of %d): %v\n", notifier.Name(), notifier.Target(), attempt+1, d.config.Retries+1, err)
+	}
+	if d.config.Store == nil {
+		return
+	}
+	for _, transition := range transitions {
+		record := store.Alert{
+			At:        transition.At,
+			Cluster:   transition.Report.Cluster,
+			Instance:  d.config.Instance,
+			Notifier:  notifier.Name(),
+			Target:    notifier.Target(),
+			Healthy:   transition.Report.Healthy,
+			Message:   transition.Report.Message,
+			Delivered: err == nil,
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		if err := d.config.Store.SaveAlert(record); err != nil {
+			fmt.Printf("Could not store alert: %v\n", err)
+		}
+	}
+}
+
+func (d *Dispatcher) send(send func(ctx context.Context) error) error {
+	ctx := context.Background()
+	if d.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		defer cancel()
+	}
+	return send(ctx)
+}
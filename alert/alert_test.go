@@ -0,0 +1,235 @@
+package alert_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeNotifier struct {
+	mutex       sync.Mutex
+	failures    int
+	attempts    int
+	transitions []alert.Transition
+}
+
+func (f *fakeNotifier) Name() string {
+	return "fake"
+}
+
+func (f *fakeNotifier) Target() string {
+	return "fake://receiver"
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, transition alert.Transition) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.attempts++
+	if f.attempts <= f.failures {
+		return fmt.Errorf("attempt %d failed", f.attempts)
+	}
+	f.transitions = append(f.transitions, transition)
+	return nil
+}
+
+func (f *fakeNotifier) kinds() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var kinds []string
+	for _, transition := range f.transitions {
+		kinds = append(kinds, transition.Kind)
+	}
+	return kinds
+}
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		notifier   *fakeNotifier
+		config     alert.Config
+		dispatcher *alert.Dispatcher
+		start      time.Time
+	)
+
+	report := func(minutes int, message string) health.Report {
+		return health.Report{
+			Cluster:    "cf",
+			Deployment: "cf-12345",
+			Healthy:    message == health.MessageHealthy,
+			Message:    message,
+			CheckedAt:  start.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+
+	BeforeEach(func() {
+		notifier = &fakeNotifier{}
+		config = alert.Config{Retries: 2, Backoff: time.Millisecond, DedupWindow: 30 * time.Minute}
+		start = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	JustBeforeEach(func() {
+		dispatcher = alert.NewDispatcher([]alert.Notifier{notifier}, config)
+	})
+
+	It("does not alert while the cluster stays healthy", func() {
+		_, sent := dispatcher.Observe(report(0, health.MessageHealthy))
+		Ω(sent).Should(BeFalse())
+		_, sent = dispatcher.Observe(report(1, health.MessageHealthy))
+		Ω(sent).Should(BeFalse())
+	})
+
+	It("alerts once when the cluster becomes unhealthy and once when it recovers", func() {
+		dispatcher.Observe(report(0, health.MessageHealthy))
+		transition, sent := dispatcher.Observe(report(1, health.MessageTooManyLeaders))
+		Ω(sent).Should(BeTrue())
+		Ω(transition.Cluster).Should(Equal("cf"))
+		Ω(transition.PreviousHealthy).Should(BeTrue())
+		dispatcher.Observe(report(2, health.MessageTooManyLeaders))
+		transition, sent = dispatcher.Observe(report(3, health.MessageHealthy))
+		Ω(sent).Should(BeTrue())
+		Ω(transition.PreviousMessage).Should(Equal(health.MessageTooManyLeaders))
+		dispatcher.Wait()
+		Ω(notifier.kinds()).Should(Equal([]string{alert.KindUnhealthy, alert.KindResolved}))
+	})
+
+	It("alerts when the first check finds the cluster unhealthy", func() {
+		_, sent := dispatcher.Observe(report(0, health.MessageQuorumLost))
+		Ω(sent).Should(BeTrue())
+	})
+
+	It("alerts when the reason changes but not when it changes back within the dedup window", func() {
+		dispatcher.Observe(report(0, health.MessageNodeUnreachable))
+		dispatcher.Observe(report(1, health.MessageQuorumLost))
+		_, sent := dispatcher.Observe(report(2, health.MessageNodeUnreachable))
+		Ω(sent).Should(BeFalse())
+		_, sent = dispatcher.Observe(report(3, health.MessageQuorumLost))
+		Ω(sent).Should(BeFalse())
+		_, sent = dispatcher.Observe(report(40, health.MessageNodeUnreachable))
+		Ω(sent).Should(BeTrue())
+		dispatcher.Wait()
+		Ω(notifier.kinds()).Should(Equal([]string{alert.KindUnhealthy, alert.KindChanged, alert.KindChanged}))
+	})
+
+	It("always announces recovery and a new fault after it, however quickly", func() {
+		dispatcher.Observe(report(0, health.MessageNodeUnreachable))
+		dispatcher.Observe(report(1, health.MessageHealthy))
+		_, sent := dispatcher.Observe(report(2, health.MessageNodeUnreachable))
+		Ω(sent).Should(BeTrue())
+	})
+
+	It("tracks what was announced separately for each cluster", func() {
+		cf := report(0, health.MessageQuorumLost)
+		cf.Cluster = "cf"
+		diego := report(0, health.MessageQuorumLost)
+		diego.Cluster = "diego"
+		_, sent := dispatcher.Observe(cf)
+		Ω(sent).Should(BeTrue())
+		_, sent = dispatcher.Observe(diego)
+		Ω(sent).Should(BeTrue())
+
+		cf.Healthy, cf.Message = true, health.MessageHealthy
+		transition, sent := dispatcher.Observe(cf)
+		Ω(sent).Should(BeTrue())
+		Ω(transition.Kind).Should(Equal(alert.KindResolved))
+		_, sent = dispatcher.Observe(diego)
+		Ω(sent).Should(BeFalse())
+	})
+
+	Context("when restarted with a store", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "alerts")
+			Ω(err).Should(BeNil())
+			config.Store, err = store.NewFileStore(dir, 0)
+			Ω(err).Should(BeNil())
+			config.Instance = "0"
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		restart := func() {
+			dispatcher.Wait()
+			notifier = &fakeNotifier{}
+			dispatcher = alert.NewDispatcher([]alert.Notifier{notifier}, config)
+		}
+
+		It("does not announce an outage again that was announced before the restart", func() {
+			dispatcher.Observe(report(0, health.MessageQuorumLost))
+			restart()
+			_, sent := dispatcher.Observe(report(1, health.MessageQuorumLost))
+			Ω(sent).Should(BeFalse())
+		})
+
+		It("announces a recovery that happened while the monitor was down", func() {
+			dispatcher.Observe(report(0, health.MessageQuorumLost))
+			restart()
+			transition, sent := dispatcher.Observe(report(5, health.MessageHealthy))
+			Ω(sent).Should(BeTrue())
+			Ω(transition.Kind).Should(Equal(alert.KindResolved))
+			Ω(transition.PreviousMessage).Should(Equal(health.MessageQuorumLost))
+		})
+
+		It("ignores the alerts of other instances", func() {
+			Ω(config.Store.SaveAlert(store.Alert{At: start, Cluster: "cf", Instance: "1", Healthy: false, Message: health.MessageQuorumLost})).Should(Succeed())
+			restart()
+			_, sent := dispatcher.Observe(report(1, health.MessageHealthy))
+			Ω(sent).Should(BeFalse())
+		})
+	})
+
+	Context("when delivery fails", func() {
+		BeforeEach(func() {
+			notifier.failures = 2
+		})
+
+		It("retries until it succeeds", func() {
+			dispatcher.Observe(report(0, health.MessageQuorumLost))
+			dispatcher.Wait()
+			Ω(notifier.attempts).Should(Equal(3))
+			Ω(notifier.kinds()).Should(Equal([]string{alert.KindUnhealthy}))
+		})
+
+		Context("more times than the retries allow", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				notifier.failures = 5
+				dir, err = ioutil.TempDir("", "alerts")
+				Ω(err).Should(BeNil())
+				config.Store, err = store.NewFileStore(dir, 0)
+				Ω(err).Should(BeNil())
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("gives up and records the undelivered alert", func() {
+				dispatcher.Observe(report(0, health.MessageQuorumLost))
+				dispatcher.Wait()
+				Ω(notifier.attempts).Should(Equal(3))
+				alerts, err := config.Store.Alerts(time.Time{})
+				Ω(err).Should(BeNil())
+				Ω(alerts).Should(HaveLen(1))
+				Ω(alerts[0].Notifier).Should(Equal("fake"))
+				Ω(alerts[0].Delivered).Should(BeFalse())
+				Ω(alerts[0].Error).Should(Equal("attempt 3 failed"))
+			})
+		})
+	})
+})
@@ -0,0 +1,144 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Email - sends transitions through an SMTP server, optionally batching those within a window into a digest
+type Email struct {
+	Host         string
+	Port         int
+	StartTLS     bool
+	Username     string
+	Password     string
+	From         string
+	To           []string
+	DigestWindow time.Duration
+}
+
+// Name - returns email
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Target - returns the SMTP server and recipients
+func (e *Email) Target() string {
+	return fmt.Sprintf("smtp://%s to %s", e.address(), strings.Join(e.To, ","))
+}
+
+// Window - the digest window, zero sends an email per transition
+func (e *Email) Window() time.Duration {
+	return e.DigestWindow
+}
+
+// Notify - emails a single transition
+func (e *Email) Notify(ctx context.Context, transition Transition) error {
+	return e.NotifyBatch(ctx, []Transition{transition})
+}
+
+// NotifyBatch - emails the transitions, as a digest when there are several
+func (e *Email) NotifyBatch(ctx context.Context, transitions []Transition) error {
+	return e.send(ctx, EmailMessage(e.From, e.To, transitions))
+}
+
+func (e *Email) address() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// send - delivers a message, upgrading the connection with STARTTLS and authenticating when configured
+func (e *Email) send(ctx context.Context, message []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.address())
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", e.address())
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: e.Host}); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// EmailMessage - renders transitions as a plain text email, a single transition is summarised in the subject
+// and several are combined into a digest ending with the most recent node table
+func EmailMessage(from string, to []string, transitions []Transition) []byte {
+	last := transitions[len(transitions)-1]
+	subject := title(last)
+	if len(transitions) > 1 {
+		subject = fmt.Sprintf("%s digest: %d changes, now %s", clusterName(last), len(transitions), strings.ToLower(last.Report.Message))
+	}
+
+	var body bytes.Buffer
+	for _, transition := range transitions {
+		fmt.Fprintf(&body, "%s - %s\r\n", transition.At.UTC().Format(time.RFC1123), title(transition))
+		if transition.Kind == KindResolved {
+			fmt.Fprintf(&body, "Was: %s\r\n", transition.PreviousMessage)
+		}
+		for _, problem := range problemLines(transition.Report) {
+			fmt.Fprintf(&body, "  * %s\r\n", problem)
+		}
+		body.WriteString("\r\n")
+	}
+	fmt.Fprintf(&body, "Leader: %s\r\n\r\n", leaderSummary(last.Report))
+	body.WriteString(strings.Replace(textTable(last.Report), "\n", "\r\n", -1))
+	body.WriteString("\r\n")
+	if last.MonitorURL != "" {
+		fmt.Fprintf(&body, "\r\nOpen the monitor: %s\r\n", last.MonitorURL)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", last.At.UTC().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes()
+}
@@ -0,0 +1,167 @@
+package alert_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// smtpMessage - what the fake SMTP server received in one session
+type smtpMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer - accepts mail over plain SMTP with PLAIN authentication and without STARTTLS
+func fakeSMTPServer() (net.Listener, chan smtpMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Ω(err).Should(BeNil())
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return listener, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan smtpMessage) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	var message smtpMessage
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			message.auth = string(decoded)
+			reply("235 Authenticated")
+		case "MAIL":
+			message.from = strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")
+			reply("250 OK")
+		case "RCPT":
+			message.to = append(message.to, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var data []string
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data = append(data, line)
+			}
+			message.data = strings.Join(data, "")
+			messages <- message
+			reply("250 Queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Not implemented")
+		}
+	}
+}
+
+var _ = Describe("Email", func() {
+	var (
+		listener net.Listener
+		messages chan smtpMessage
+		email    *alert.Email
+	)
+
+	BeforeEach(func() {
+		listener, messages = fakeSMTPServer()
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		portNumber, _ := strconv.Atoi(port)
+		email = &alert.Email{
+			Host:     host,
+			Port:     portNumber,
+			Username: "monitor",
+			Password: "secret",
+			From:     "etcd-leader-monitor@example.com",
+			To:       []string{"ops@example.com", "oncall@example.com"},
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	It("authenticates and sends an email for a transition to every recipient", func() {
+		Ω(email.Notify(context.Background(), tooManyLeaders)).Should(Succeed())
+		var message smtpMessage
+		Eventually(messages).Should(Receive(&message))
+		Ω(message.auth).Should(Equal("\x00monitor\x00secret"))
+		Ω(message.from).Should(Equal("etcd-leader-monitor@example.com"))
+		Ω(message.to).Should(Equal([]string{"ops@example.com", "oncall@example.com"}))
+		Ω(message.data).Should(ContainSubstring("Subject: cf-12345 etcd cluster is unhealthy: Too many leaders\r\n"))
+		Ω(message.data).Should(ContainSubstring("To: ops@example.com, oncall@example.com\r\n"))
+		Ω(message.data).Should(ContainSubstring("  * Too many leaders: 2 nodes claim leadership: [1.1.1.1 2.2.2.2]\r\n"))
+		Ω(message.data).Should(ContainSubstring("3.3.3.3  etcd_server/2  -       0          unreachable (timeout)\r\n"))
+		Ω(message.data).Should(ContainSubstring("Open the monitor: https://etcd-leader-monitor.example.com\r\n"))
+	})
+
+	It("refuses to send without STARTTLS when it is required", func() {
+		email.StartTLS = true
+		Ω(email.Notify(context.Background(), tooManyLeaders)).Should(MatchError(ContainSubstring("does not support STARTTLS")))
+		Consistently(messages).ShouldNot(Receive())
+	})
+
+	Describe("#EmailMessage", func() {
+		It("combines several transitions into a digest", func() {
+			message := string(alert.EmailMessage("from@example.com", []string{"to@example.com"}, []alert.Transition{tooManyLeaders, recovered}))
+			Ω(message).Should(ContainSubstring("Subject: cf-12345 etcd cluster digest: 2 changes, now everything is healthy\r\n"))
+			Ω(message).Should(ContainSubstring("Sun, 01 Jan 2017 12:00:00 UTC - cf-12345 etcd cluster is unhealthy: Too many leaders\r\n"))
+			Ω(message).Should(ContainSubstring("Sun, 01 Jan 2017 12:05:00 UTC - Resolved: cf-12345 etcd cluster is healthy again\r\nWas: Too many leaders\r\n"))
+			Ω(message).Should(ContainSubstring("Leader: 1.1.1.1 with 1 of 1 followers\r\n"))
+		})
+	})
+
+	Context("with a digest window", func() {
+		It("batches the transitions within the window into one email", func() {
+			email.DigestWindow = 50 * time.Millisecond
+			dispatcher := alert.NewDispatcher([]alert.Notifier{email}, alert.Config{})
+			_, sent := dispatcher.Observe(tooManyLeaders.Report)
+			Ω(sent).Should(BeTrue())
+			_, sent = dispatcher.Observe(recovered.Report)
+			Ω(sent).Should(BeTrue())
+			dispatcher.Wait()
+
+			var message smtpMessage
+			Eventually(messages).Should(Receive(&message))
+			Ω(message.data).Should(ContainSubstring("digest: 2 changes"))
+			Consistently(messages).ShouldNot(Receive())
+		})
+	})
+})
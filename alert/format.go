@@ -0,0 +1,129 @@
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+)
+
+// nodeColumns - the headings of the node table rendered in chat messages
+var nodeColumns = []string{"IP", "Job", "Role", "Followers", "State"}
+
+// title - a one line summary of the transition
+func title(transition Transition) string {
+	switch transition.Kind {
+	case KindResolved:
+		return fmt.Sprintf("Resolved: %s is healthy again", clusterName(transition))
+	case KindChanged:
+		return fmt.Sprintf("%s is still unhealthy: %s", clusterName(transition), transition.Report.Message)
+	default:
+		return fmt.Sprintf("%s is unhealthy: %s", clusterName(transition), transition.Report.Message)
+	}
+}
+
+// clusterName - names the cluster, along with its deployment when that is known and named differently
+func clusterName(transition Transition) string {
+	name, deployment := transition.Cluster, transition.Report.Deployment
+	switch {
+	case name == "" && deployment == "":
+		return "etcd cluster"
+	case name == "":
+		return deployment + " etcd cluster"
+	case deployment == "" || deployment == name:
+		return name + " etcd cluster"
+	default:
+		return fmt.Sprintf("%s etcd cluster (%s)", name, deployment)
+	}
+}
+
+// leaderSummary - who the leader is and how many followers it has, or why there is not exactly one leader
+func leaderSummary(report health.Report) string {
+	var leaders []string
+	for _, node := range report.Nodes {
+		if node.Reachable && node.Leader {
+			leaders = append(leaders, fmt.Sprintf("%s with %d of %d followers", describeNode(node), node.Followers, len(report.Nodes)-1))
+		}
+	}
+	if len(leaders) == 0 {
+		return "no leader"
+	}
+	return strings.Join(leaders, ", ")
+}
+
+func describeNode(node health.Node) string {
+	if node.Name == "" {
+		return node.IP
+	}
+	return fmt.Sprintf("%s (%s)", node.IP, node.Name)
+}
+
+// problemLines - one line per problem found
+func problemLines(report health.Report) []string {
+	var lines []string
+	for _, problem := range report.Problems {
+		line := problem.Message
+		if problem.IP != "" {
+			line += " on " + problem.IP
+		}
+		if problem.Detail != "" {
+			line += ": " + problem.Detail
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// nodeRows - a row of the node table for every node in the report
+func nodeRows(report health.Report) [][]string {
+	var rows [][]string
+	for _, node := range report.Nodes {
+		role := "follower"
+		if node.Leader {
+			role = "leader"
+		}
+		state := "reachable"
+		if !node.Reachable {
+			role = "-"
+			state = "unreachable"
+			if node.ErrorReason != "" {
+				state += " (" + node.ErrorReason + ")"
+			}
+		}
+		rows = append(rows, []string{
+			node.IP,
+			fmt.Sprintf("%s/%d", node.JobName, node.Index),
+			role,
+			strconv.Itoa(node.Followers),
+			state,
+		})
+	}
+	return rows
+}
+
+// textTable - the node table aligned for a monospaced font
+func textTable(report health.Report) string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(nodeColumns, "\t"))
+	for _, row := range nodeRows(report) {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	writer.Flush()
+	return strings.TrimRight(buffer.String(), "\n")
+}
+
+// markdownTable - the node table as a markdown table
+func markdownTable(report health.Report) string {
+	lines := []string{
+		"| " + strings.Join(nodeColumns, " | ") + " |",
+		"|" + strings.Repeat(" --- |", len(nodeColumns)),
+	}
+	for _, row := range nodeRows(report) {
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+	}
+	return strings.Join(lines, "\n")
+}
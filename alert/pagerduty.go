@@ -0,0 +1,136 @@
+package alert
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+)
+
+const (
+	// PagerDutyEventsURL - the PagerDuty Events API v2 endpoint
+	PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+	pagerDutyTrigger = "trigger"
+	pagerDutyResolve = "resolve"
+)
+
+// PagerDuty severities, from most to least urgent
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+)
+
+// PagerDuty - opens a PagerDuty incident through the Events API v2 when the cluster becomes unhealthy and resolves it on recovery
+type PagerDuty struct {
+	RoutingKey string
+	URL        string
+	HTTPClient *http.Client
+}
+
+// PagerDutyEvent - an Events API v2 event
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+	Links       []PagerDutyLink   `json:"links,omitempty"`
+}
+
+// PagerDutyPayload - the details of a triggered incident
+type PagerDutyPayload struct {
+	Summary       string        `json:"summary"`
+	Source        string        `json:"source"`
+	Severity      string        `json:"severity"`
+	Timestamp     string        `json:"timestamp"`
+	Component     string        `json:"component,omitempty"`
+	Group         string        `json:"group,omitempty"`
+	Class         string        `json:"class"`
+	CustomDetails health.Report `json:"custom_details"`
+}
+
+// PagerDutyLink - a link shown on the incident
+type PagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// NewPagerDuty - returns a notifier sending events for the given integration routing key, to url or PagerDutyEventsURL when empty
+func NewPagerDuty(routingKey string, url string, httpClient *http.Client) *PagerDuty {
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+	return &PagerDuty{RoutingKey: routingKey, URL: url, HTTPClient: httpClient}
+}
+
+// Name - returns pagerduty
+func (p *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+// Target - returns the events endpoint host
+func (p *PagerDuty) Target() string {
+	return redactURL(p.URL)
+}
+
+// Notify - triggers the cluster's incident, or resolves it when the cluster recovered
+func (p *PagerDuty) Notify(ctx context.Context, transition Transition) error {
+	return postJSON(ctx, p.HTTPClient, p.URL, NewPagerDutyEvent(p.RoutingKey, transition))
+}
+
+// NewPagerDutyEvent - renders the transition as an Events API v2 event. Triggering again while the cluster stays
+// unhealthy updates the open incident, as the dedup key only depends on which cluster it is.
+func NewPagerDutyEvent(routingKey string, transition Transition) PagerDutyEvent {
+	report := transition.Report
+	event := PagerDutyEvent{
+		RoutingKey: routingKey,
+		DedupKey:   DedupKey(report),
+	}
+	if transition.Kind == KindResolved {
+		event.EventAction = pagerDutyResolve
+		return event
+	}
+	event.EventAction = pagerDutyTrigger
+	event.Payload = &PagerDutyPayload{
+		Summary:       title(transition),
+		Source:        transition.Cluster,
+		Severity:      Severity(report.Message),
+		Timestamp:     transition.At.UTC().Format(time.RFC3339),
+		Component:     report.Job,
+		Group:         report.Deployment,
+		Class:         report.Message,
+		CustomDetails: report,
+	}
+	if event.Payload.Source == "" {
+		event.Payload.Source = "etcd"
+	}
+	if transition.MonitorURL != "" {
+		event.Links = []PagerDutyLink{{Href: transition.MonitorURL, Text: "Open the monitor"}}
+	}
+	return event
+}
+
+// DedupKey - identifies a BOSH cluster by director UUID, deployment and etcd job so that one incident is kept per
+// cluster even when several foundations page the same service, and a cluster found without BOSH by its name
+func DedupKey(report health.Report) string {
+	if report.Director != "" || report.Deployment != "" {
+		return strings.Join([]string{"etcd-leader-monitor", report.Director, report.Deployment, report.Job}, "/")
+	}
+	return strings.Join([]string{"etcd-leader-monitor", report.Cluster}, "/")
+}
+
+// Severity - how urgent a verdict is; a cluster that cannot agree on a leader or lost quorum is critical,
+// a slow or lagging node is a warning
+func Severity(message string) string {
+	switch message {
+	case health.MessageQuorumLost, health.MessageSplitBrain, health.MessageTooManyLeaders, health.MessageNotEnoughLeaders:
+		return SeverityCritical
+	case health.MessageFollowerDegraded, health.MessageIndexLag, health.MessageStaleMember, health.MessageStale:
+		return SeverityWarning
+	default:
+		return SeverityError
+	}
+}
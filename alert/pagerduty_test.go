@@ -0,0 +1,98 @@
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PagerDuty", func() {
+	var identified = func(transition alert.Transition) alert.Transition {
+		transition.Report.Cluster = "cf"
+		transition.Report.DirectorName = "london"
+		transition.Report.Director = "2daf673a-9755-4b4f-aa6d-3632fbed8019"
+		transition.Report.Deployment = "cf-12345"
+		transition.Report.Job = "etcd_server"
+		return transition
+	}
+
+	Describe("#NewPagerDutyEvent", func() {
+		It("triggers an incident keyed by director and cluster name", func() {
+			event := alert.NewPagerDutyEvent("routing-key", identified(tooManyLeaders))
+			Ω(event.RoutingKey).Should(Equal("routing-key"))
+			Ω(event.EventAction).Should(Equal("trigger"))
+			Ω(event.DedupKey).Should(Equal("etcd-leader-monitor/2daf673a-9755-4b4f-aa6d-3632fbed8019/cf-12345/etcd_server"))
+			Ω(event.Payload.Summary).Should(Equal("cf-12345 etcd cluster is unhealthy: Too many leaders"))
+			Ω(event.Payload.Source).Should(Equal("cf-12345"))
+			Ω(event.Payload.Severity).Should(Equal(alert.SeverityCritical))
+			Ω(event.Payload.Timestamp).Should(Equal("2017-01-01T12:00:00Z"))
+			Ω(event.Payload.Component).Should(Equal("etcd_server"))
+			Ω(event.Payload.Class).Should(Equal("Too many leaders"))
+			Ω(event.Payload.CustomDetails.Nodes).Should(HaveLen(3))
+			Ω(event.Links).Should(Equal([]alert.PagerDutyLink{{Href: "https://etcd-leader-monitor.example.com", Text: "Open the monitor"}}))
+		})
+
+		It("resolves the same incident when the cluster recovers", func() {
+			event := alert.NewPagerDutyEvent("routing-key", identified(recovered))
+			Ω(event.EventAction).Should(Equal("resolve"))
+			Ω(event.DedupKey).Should(Equal(alert.NewPagerDutyEvent("routing-key", identified(tooManyLeaders)).DedupKey))
+			Ω(event.Payload).Should(BeNil())
+		})
+	})
+
+	Describe("#DedupKey", func() {
+		It("keeps a separate incident for each cluster found without BOSH", func() {
+			Ω(alert.DedupKey(health.Report{Cluster: "k8s"})).Should(Equal("etcd-leader-monitor/k8s"))
+			Ω(alert.DedupKey(health.Report{Cluster: "vault"})).Should(Equal("etcd-leader-monitor/vault"))
+		})
+
+		It("tells apart default clusters of different foundations by their director", func() {
+			london := health.Report{Cluster: "default", DirectorName: "default", Director: "2daf673a-9755-4b4f-aa6d-3632fbed8019", Deployment: "cf-12345", Job: "etcd_server"}
+			dublin := london
+			dublin.Director = "8c5b2b3a-1f7e-4d3c-9a6b-0e4f2d1c7b9a"
+			Ω(alert.DedupKey(london)).ShouldNot(Equal(alert.DedupKey(dublin)))
+		})
+	})
+
+	Describe("#Severity", func() {
+		It("maps verdicts to PagerDuty severities", func() {
+			Ω(alert.Severity(health.MessageTooManyLeaders)).Should(Equal(alert.SeverityCritical))
+			Ω(alert.Severity(health.MessageQuorumLost)).Should(Equal(alert.SeverityCritical))
+			Ω(alert.Severity(health.MessageNodeUnreachable)).Should(Equal(alert.SeverityError))
+			Ω(alert.Severity(health.MessageFollowerDegraded)).Should(Equal(alert.SeverityWarning))
+			Ω(alert.Severity(health.MessageIndexLag)).Should(Equal(alert.SeverityWarning))
+		})
+	})
+
+	Describe("#Notify", func() {
+		It("sends the event to the configured endpoint", func() {
+			var raw map[string]interface{}
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Ω(r.URL.Path).Should(Equal("/v2/enqueue"))
+				Ω(json.NewDecoder(r.Body).Decode(&raw)).Should(Succeed())
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer receiver.Close()
+
+			pagerDuty := alert.NewPagerDuty("routing-key", receiver.URL+"/v2/enqueue", &http.Client{})
+			Ω(pagerDuty.Notify(context.Background(), identified(recovered))).Should(Succeed())
+			Ω(raw).Should(Equal(map[string]interface{}{
+				"routing_key":  "routing-key",
+				"event_action": "resolve",
+				"dedup_key":    "etcd-leader-monitor/2daf673a-9755-4b4f-aa6d-3632fbed8019/cf-12345/etcd_server",
+			}))
+		})
+
+		It("defaults to the PagerDuty Events API", func() {
+			pagerDuty := alert.NewPagerDuty("routing-key", "", &http.Client{})
+			Ω(pagerDuty.URL).Should(Equal(alert.PagerDutyEventsURL))
+			Ω(pagerDuty.Target()).Should(Equal("https://events.pagerduty.com"))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Slack - posts transitions to a Slack incoming webhook as Block Kit messages
+type Slack struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// SlackMessage - an incoming webhook payload, text is shown in notifications and where blocks are not supported
+type SlackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackBlock - a single Block Kit layout block
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+// SlackText - a Block Kit text object
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// NewSlack - returns a notifier posting to the given Slack incoming webhook URL
+func NewSlack(url string, httpClient *http.Client) *Slack {
+	return &Slack{URL: url, HTTPClient: httpClient}
+}
+
+// Name - returns slack
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+// Target - returns the webhook host, the path holds the webhook's secret
+func (s *Slack) Target() string {
+	return redactURL(s.URL)
+}
+
+// Notify - posts the transition as a Block Kit message
+func (s *Slack) Notify(ctx context.Context, transition Transition) error {
+	return postJSON(ctx, s.HTTPClient, s.URL, SlackPayload(transition))
+}
+
+// SlackPayload - renders the transition as a Block Kit message with the leader, problems and node table
+func SlackPayload(transition Transition) SlackMessage {
+	report := transition.Report
+	icon := ":red_circle:"
+	summary := fmt.Sprintf("*Leader:* %s", leaderSummary(report))
+	if transition.Kind == KindResolved {
+		icon = ":large_green_circle:"
+		summary = fmt.Sprintf("*Was:* %s\n%s", transition.PreviousMessage, summary)
+	} else if problems := problemLines(report); len(problems) > 0 {
+		summary = fmt.Sprintf("%s\n*Problems:*\n• %s", summary, strings.Join(problems, "\n• "))
+	}
+
+	footer := fmt.Sprintf("Checked at %s", transition.At.UTC().Format(time.RFC1123))
+	if transition.MonitorURL != "" {
+		footer += fmt.Sprintf(" | <%s|Open the monitor>", transition.MonitorURL)
+	}
+	return SlackMessage{
+		Text: title(transition),
+		Blocks: []SlackBlock{
+			{Type: "header", Text: &SlackText{Type: "plain_text", Text: fmt.Sprintf("%s %s", icon, title(transition))}},
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: summary}},
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "```\n" + textTable(report) + "\n```"}},
+			{Type: "context", Elements: []SlackText{{Type: "mrkdwn", Text: footer}}},
+		},
+	}
+}
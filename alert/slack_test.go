@@ -0,0 +1,101 @@
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var tooManyLeaders = alert.Transition{
+	Kind:       alert.KindUnhealthy,
+	At:         time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC),
+	Cluster:    "cf-12345",
+	MonitorURL: "https://etcd-leader-monitor.example.com",
+	Report: health.Report{
+		Message: health.MessageTooManyLeaders,
+		Problems: []health.Problem{
+			{Message: health.MessageTooManyLeaders, Detail: "2 nodes claim leadership: [1.1.1.1 2.2.2.2]"},
+		},
+		Nodes: []health.Node{
+			{IP: "1.1.1.1", Name: "etcd-0", JobName: "etcd_server", Index: 0, Reachable: true, Leader: true, Followers: 1},
+			{IP: "2.2.2.2", JobName: "etcd_server", Index: 1, Reachable: true, Leader: true, Followers: 0},
+			{IP: "3.3.3.3", JobName: "etcd_server", Index: 2, ErrorReason: "timeout"},
+		},
+	},
+}
+
+var recovered = alert.Transition{
+	Kind:            alert.KindResolved,
+	At:              time.Date(2017, 1, 1, 12, 5, 0, 0, time.UTC),
+	Cluster:         "cf-12345",
+	PreviousMessage: health.MessageTooManyLeaders,
+	Report: health.Report{
+		Healthy: true,
+		Message: health.MessageHealthy,
+		Nodes: []health.Node{
+			{IP: "1.1.1.1", JobName: "etcd_server", Index: 0, Reachable: true, Leader: true, Followers: 1},
+			{IP: "2.2.2.2", JobName: "etcd_server", Index: 1, Reachable: true},
+		},
+	},
+}
+
+var _ = Describe("Slack", func() {
+	Describe("#SlackPayload", func() {
+		It("renders the leader, problems, node table and a link to the monitor", func() {
+			message := alert.SlackPayload(tooManyLeaders)
+			Ω(message.Text).Should(Equal("cf-12345 etcd cluster is unhealthy: Too many leaders"))
+			Ω(message.Blocks).Should(HaveLen(4))
+			Ω(message.Blocks[0].Type).Should(Equal("header"))
+			Ω(message.Blocks[0].Text.Text).Should(Equal(":red_circle: cf-12345 etcd cluster is unhealthy: Too many leaders"))
+			Ω(message.Blocks[1].Text.Text).Should(Equal("*Leader:* 1.1.1.1 (etcd-0) with 1 of 2 followers, 2.2.2.2 with 0 of 2 followers\n" +
+				"*Problems:*\n• Too many leaders: 2 nodes claim leadership: [1.1.1.1 2.2.2.2]"))
+			Ω(message.Blocks[2].Text.Text).Should(Equal("```\n" +
+				"IP       Job            Role    Followers  State\n" +
+				"1.1.1.1  etcd_server/0  leader  1          reachable\n" +
+				"2.2.2.2  etcd_server/1  leader  0          reachable\n" +
+				"3.3.3.3  etcd_server/2  -       0          unreachable (timeout)\n" +
+				"```"))
+			Ω(message.Blocks[3].Elements[0].Text).Should(Equal("Checked at Sun, 01 Jan 2017 12:00:00 UTC | <https://etcd-leader-monitor.example.com|Open the monitor>"))
+		})
+
+		It("tells apart clusters in the same deployment and names clusters that have no deployment", func() {
+			transition := tooManyLeaders
+			transition.Cluster = "diego"
+			transition.Report.Deployment = "cf-12345"
+			Ω(alert.SlackPayload(transition).Text).Should(Equal("diego etcd cluster (cf-12345) is unhealthy: Too many leaders"))
+			transition.Cluster = "k8s"
+			transition.Report.Deployment = ""
+			Ω(alert.SlackPayload(transition).Text).Should(Equal("k8s etcd cluster is unhealthy: Too many leaders"))
+		})
+
+		It("renders a separate resolved message", func() {
+			message := alert.SlackPayload(recovered)
+			Ω(message.Text).Should(Equal("Resolved: cf-12345 etcd cluster is healthy again"))
+			Ω(message.Blocks[0].Text.Text).Should(HavePrefix(":large_green_circle:"))
+			Ω(message.Blocks[1].Text.Text).Should(Equal("*Was:* Too many leaders\n*Leader:* 1.1.1.1 with 1 of 1 followers"))
+			Ω(message.Blocks[3].Elements[0].Text).ShouldNot(ContainSubstring("Open the monitor"))
+		})
+	})
+
+	Describe("#Notify", func() {
+		It("posts the Block Kit message to the incoming webhook", func() {
+			var message alert.SlackMessage
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Ω(json.NewDecoder(r.Body).Decode(&message)).Should(Succeed())
+			}))
+			defer receiver.Close()
+
+			slack := alert.NewSlack(receiver.URL+"/services/T000/B000/XXXX", &http.Client{})
+			Ω(slack.Notify(context.Background(), tooManyLeaders)).Should(Succeed())
+			Ω(message).Should(Equal(alert.SlackPayload(tooManyLeaders)))
+			Ω(slack.Target()).Should(Equal(receiver.URL))
+		})
+	})
+})
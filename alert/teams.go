@@ -0,0 +1,114 @@
+package alert
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	teamsUnhealthyColour = "D70000"
+	teamsResolvedColour  = "2EB886"
+)
+
+// Teams - posts transitions to a Microsoft Teams incoming webhook as MessageCards
+type Teams struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// TeamsCard - a legacy actionable MessageCard, as accepted by Teams incoming webhooks
+type TeamsCard struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Sections        []TeamsSection `json:"sections"`
+	PotentialAction []TeamsAction  `json:"potentialAction,omitempty"`
+}
+
+// TeamsSection - a section of a MessageCard
+type TeamsSection struct {
+	ActivityTitle string      `json:"activityTitle,omitempty"`
+	Facts         []TeamsFact `json:"facts,omitempty"`
+	Text          string      `json:"text,omitempty"`
+	Markdown      bool        `json:"markdown"`
+}
+
+// TeamsFact - a name and value pair shown in a section
+type TeamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// TeamsAction - an OpenUri action linking back to the monitor
+type TeamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []TeamsTarget `json:"targets"`
+}
+
+// TeamsTarget - where an OpenUri action leads
+type TeamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+// NewTeams - returns a notifier posting to the given Teams incoming webhook URL
+func NewTeams(url string, httpClient *http.Client) *Teams {
+	return &Teams{URL: url, HTTPClient: httpClient}
+}
+
+// Name - returns teams
+func (t *Teams) Name() string {
+	return "teams"
+}
+
+// Target - returns the webhook host, the path holds the webhook's secret
+func (t *Teams) Target() string {
+	return redactURL(t.URL)
+}
+
+// Notify - posts the transition as a MessageCard
+func (t *Teams) Notify(ctx context.Context, transition Transition) error {
+	return postJSON(ctx, t.HTTPClient, t.URL, TeamsPayload(transition))
+}
+
+// TeamsPayload - renders the transition as a MessageCard with the leader, problems and node table
+func TeamsPayload(transition Transition) TeamsCard {
+	report := transition.Report
+	colour := teamsUnhealthyColour
+	facts := []TeamsFact{
+		{Name: "Verdict", Value: report.Message},
+		{Name: "Leader", Value: leaderSummary(report)},
+	}
+	if transition.Kind == KindResolved {
+		colour = teamsResolvedColour
+		facts = append(facts, TeamsFact{Name: "Was", Value: transition.PreviousMessage})
+	} else if problems := problemLines(report); len(problems) > 0 {
+		facts = append(facts, TeamsFact{Name: "Problems", Value: strings.Join(problems, "<br>")})
+	}
+	facts = append(facts, TeamsFact{Name: "Checked at", Value: transition.At.UTC().Format(time.RFC1123)})
+
+	card := TeamsCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: colour,
+		Summary:    title(transition),
+		Title:      title(transition),
+		Sections: []TeamsSection{
+			{Facts: facts, Markdown: true},
+			{ActivityTitle: "Nodes", Text: markdownTable(report), Markdown: true},
+		},
+	}
+	if transition.MonitorURL != "" {
+		card.PotentialAction = []TeamsAction{{
+			Type:    "OpenUri",
+			Name:    "Open the monitor",
+			Targets: []TeamsTarget{{OS: "default", URI: transition.MonitorURL}},
+		}}
+	}
+	return card
+}
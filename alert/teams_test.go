@@ -0,0 +1,63 @@
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Teams", func() {
+	Describe("#TeamsPayload", func() {
+		It("renders the leader, problems, node table and a link to the monitor", func() {
+			card := alert.TeamsPayload(tooManyLeaders)
+			Ω(card.Type).Should(Equal("MessageCard"))
+			Ω(card.ThemeColor).Should(Equal("D70000"))
+			Ω(card.Title).Should(Equal("cf-12345 etcd cluster is unhealthy: Too many leaders"))
+			Ω(card.Sections[0].Facts).Should(Equal([]alert.TeamsFact{
+				{Name: "Verdict", Value: "Too many leaders"},
+				{Name: "Leader", Value: "1.1.1.1 (etcd-0) with 1 of 2 followers, 2.2.2.2 with 0 of 2 followers"},
+				{Name: "Problems", Value: "Too many leaders: 2 nodes claim leadership: [1.1.1.1 2.2.2.2]"},
+				{Name: "Checked at", Value: "Sun, 01 Jan 2017 12:00:00 UTC"},
+			}))
+			Ω(card.Sections[1].Text).Should(Equal("| IP | Job | Role | Followers | State |\n" +
+				"| --- | --- | --- | --- | --- |\n" +
+				"| 1.1.1.1 | etcd_server/0 | leader | 1 | reachable |\n" +
+				"| 2.2.2.2 | etcd_server/1 | leader | 0 | reachable |\n" +
+				"| 3.3.3.3 | etcd_server/2 | - | 0 | unreachable (timeout) |"))
+			Ω(card.PotentialAction).Should(Equal([]alert.TeamsAction{{
+				Type:    "OpenUri",
+				Name:    "Open the monitor",
+				Targets: []alert.TeamsTarget{{OS: "default", URI: "https://etcd-leader-monitor.example.com"}},
+			}}))
+		})
+
+		It("renders a separate resolved card", func() {
+			card := alert.TeamsPayload(recovered)
+			Ω(card.ThemeColor).Should(Equal("2EB886"))
+			Ω(card.Title).Should(Equal("Resolved: cf-12345 etcd cluster is healthy again"))
+			Ω(card.Sections[0].Facts).Should(ContainElement(alert.TeamsFact{Name: "Was", Value: "Too many leaders"}))
+			Ω(card.PotentialAction).Should(BeEmpty())
+		})
+	})
+
+	Describe("#Notify", func() {
+		It("posts the card to the incoming webhook", func() {
+			var card map[string]interface{}
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Ω(json.NewDecoder(r.Body).Decode(&card)).Should(Succeed())
+			}))
+			defer receiver.Close()
+
+			teams := alert.NewTeams(receiver.URL+"/webhookb2/secret", &http.Client{})
+			Ω(teams.Notify(context.Background(), tooManyLeaders)).Should(Succeed())
+			Ω(card["@type"]).Should(Equal("MessageCard"))
+			Ω(card["@context"]).Should(Equal("http://schema.org/extensions"))
+			Ω(teams.Name()).Should(Equal("teams"))
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Webhook - posts every transition as json to a URL
+type Webhook struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewWebhook - returns a notifier posting to the given URL
+func NewWebhook(url string, httpClient *http.Client) *Webhook {
+	return &Webhook{URL: url, HTTPClient: httpClient}
+}
+
+// Name - returns webhook
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Target - returns the URL without any credentials in it
+func (w *Webhook) Target() string {
+	return redactURL(w.URL)
+}
+
+// Notify - posts the transition, including the full node table
+func (w *Webhook) Notify(ctx context.Context, transition Transition) error {
+	return postJSON(ctx, w.HTTPClient, w.URL, transition)
+}
+
+// postJSON - posts a json payload, treating any status other than 2xx as a failure
+func postJSON(ctx context.Context, httpClient *http.Client, target string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", redactURL(target), resp.Status)
+	}
+	return nil
+}
+
+// redactURL - hides credentials and the path, which for chat webhooks is the secret
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "<invalid url>"
+	}
+	return fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+}
@@ -0,0 +1,70 @@
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhook", func() {
+	var (
+		receiver *httptest.Server
+		status   int
+		received []byte
+		webhook  *alert.Webhook
+	)
+
+	BeforeEach(func() {
+		status = 200
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, _ = ioutil.ReadAll(r.Body)
+			Ω(r.Method).Should(Equal("POST"))
+			Ω(r.Header.Get("Content-Type")).Should(Equal("application/json"))
+			w.WriteHeader(status)
+		}))
+		webhook = alert.NewWebhook(receiver.URL+"/hooks/secret-token", &http.Client{})
+	})
+
+	AfterEach(func() {
+		receiver.Close()
+	})
+
+	It("posts the transition with the node table", func() {
+		err := webhook.Notify(context.Background(), alert.Transition{
+			Kind:    alert.KindUnhealthy,
+			At:      time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			Cluster: "cf-12345",
+			Report: health.Report{
+				Message: health.MessageTooManyLeaders,
+				Nodes:   []health.Node{{IP: "1.1.1.1", Leader: true}, {IP: "2.2.2.2", Leader: true}},
+			},
+		})
+		Ω(err).Should(BeNil())
+
+		var payload alert.Transition
+		Ω(json.Unmarshal(received, &payload)).Should(Succeed())
+		Ω(payload.Kind).Should(Equal(alert.KindUnhealthy))
+		Ω(payload.Cluster).Should(Equal("cf-12345"))
+		Ω(payload.Report.Message).Should(Equal(health.MessageTooManyLeaders))
+		Ω(payload.Report.Nodes).Should(HaveLen(2))
+	})
+
+	It("fails when the receiver does not answer with a 2xx status", func() {
+		status = 500
+		err := webhook.Notify(context.Background(), alert.Transition{})
+		Ω(err).Should(MatchError(receiver.URL + " answered 500 Internal Server Error"))
+	})
+
+	It("does not expose the path of the URL as the target", func() {
+		Ω(webhook.Name()).Should(Equal("webhook"))
+		Ω(webhook.Target()).Should(Equal(receiver.URL))
+	})
+})
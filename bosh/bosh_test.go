@@ -299,3 +299,19 @@ var _ = Describe("#FindVMs", func() {
 		}))
 	})
 })
+
+var _ = Describe("#RunningTasks", func() {
+	It("returns the processing and queued tasks for the deployment", func() {
+		tasks := []bosh.Task{
+			{ID: 1, State: "done", Deployment: "cf-12345"},
+			{ID: 2, State: "processing", Deployment: "cf-12345"},
+			{ID: 3, State: "queued", Deployment: "cf-12345"},
+			{ID: 4, State: "processing", Deployment: "diego-12345"},
+			{ID: 5, State: "processing"},
+		}
+		running := bosh.RunningTasks(tasks, "cf-12345")
+		Ω(running).Should(HaveLen(2))
+		Ω(running[0].ID).Should(Equal(2))
+		Ω(running[1].ID).Should(Equal(3))
+	})
+})
@@ -0,0 +1,329 @@
+package bosh
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-community/gogobosh"
+)
+
+const (
+	// uaaCLIClient - the UAA client the BOSH CLI logs users in through
+	uaaCLIClient = "bosh_cli"
+	// tokenMargin - how long before it expires a UAA token is replaced
+	tokenMargin = 30 * time.Second
+)
+
+// Director - the parts of the BOSH director API the monitor uses
+type Director interface {
+	GetInfo() (gogobosh.Info, error)
+	GetDeployments() ([]gogobosh.Deployment, error)
+	GetDeployment(name string) (gogobosh.Manifest, error)
+	GetDeploymentVMs(name string) ([]gogobosh.VM, error)
+	GetRunningTasks(deployment string) ([]Task, error)
+}
+
+// Gogobosh - adapts a gogobosh client to a Director
+type Gogobosh struct {
+	*gogobosh.Client
+}
+
+// GetRunningTasks - returns the processing and queued tasks acting on a deployment
+func (g Gogobosh) GetRunningTasks(deployment string) ([]Task, error) {
+	return GetRunningTasks(g.Client, deployment)
+}
+
+// ClientConfig - how to reach and log in to a BOSH director. A director using UAA is logged in to as the UAA client
+// when ClientID is set, and as the user through the bosh_cli client otherwise. Tasks that have not finished within
+// TaskTimeout are given up on, so that a stuck director task does not block discovery for good.
+type ClientConfig struct {
+	URI               string
+	Username          string
+	Password          string
+	ClientID          string
+	ClientSecret      string
+	CACert            string
+	SkipSSLValidation bool
+	Timeout           time.Duration
+	TaskPollInterval  time.Duration
+	TaskTimeout       time.Duration
+}
+
+// Client - a BOSH director client which, unlike gogobosh, can trust the director's CA cert and log in as a UAA client
+type Client struct {
+	config     ClientConfig
+	base       *url.URL
+	httpClient *http.Client
+	mutex      sync.Mutex
+	authType   string
+	uaaURL     string
+	token      string
+	expiry     time.Time
+}
+
+// NewClient - returns a client for the director, which is not contacted until the first request
+func NewClient(config ClientConfig) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(config.URI, "/"))
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.SkipSSLValidation}
+	if config.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(config.CACert)) {
+			return nil, fmt.Errorf("Could not add director CA Cert, CA Cert was likely invalid")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.TaskPollInterval == 0 {
+		config.TaskPollInterval = time.Second
+	}
+	if config.TaskTimeout == 0 {
+		config.TaskTimeout = 5 * time.Minute
+	}
+
+	client := &Client{config: config, base: base}
+	client.httpClient = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		Timeout:   config.Timeout,
+		// the director redirects task requests to its own address, which may not be the one it is reached through
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			req.URL.Scheme = base.Scheme
+			req.URL.Host = base.Host
+			req.Header.Set("Authorization", via[0].Header.Get("Authorization"))
+			return nil
+		},
+	}
+	return client, nil
+}
+
+// GetInfo - returns the director's name, UUID and how it authenticates users
+func (c *Client) GetInfo() (gogobosh.Info, error) {
+	var info gogobosh.Info
+	resp, err := c.httpClient.Get(c.base.String() + "/info")
+	if err != nil {
+		return info, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return info, fmt.Errorf("BOSH answered %s to GET /info", resp.Status)
+	}
+	return info, decode(resp, "/info", &info)
+}
+
+// GetDeployments - returns every deployment on the director
+func (c *Client) GetDeployments() ([]gogobosh.Deployment, error) {
+	var deployments []gogobosh.Deployment
+	return deployments, c.get("/deployments", &deployments)
+}
+
+// GetDeployment - returns the manifest of a deployment
+func (c *Client) GetDeployment(name string) (gogobosh.Manifest, error) {
+	var manifest gogobosh.Manifest
+	return manifest, c.get("/deployments/"+name, &manifest)
+}
+
+// GetDeploymentVMs - returns the VMs of a deployment, waiting for the task the director lists them in
+func (c *Client) GetDeploymentVMs(name string) ([]gogobosh.VM, error) {
+	var task gogobosh.Task
+	if err := c.get("/deployments/"+name+"/vms?format=full", &task); err != nil {
+		return nil, err
+	}
+	if err := c.wait(task.ID); err != nil {
+		return nil, err
+	}
+
+	path := "/tasks/" + strconv.Itoa(task.ID) + "/output?type=result"
+	resp, err := c.request(path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.statusError(resp, path)
+	}
+	output, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var vms []gogobosh.VM
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var vm gogobosh.VM
+		if err := json.Unmarshal([]byte(line), &vm); err != nil {
+			return nil, fmt.Errorf("could not parse VM listed by task %d: %v", task.ID, err)
+		}
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+// GetRunningTasks - returns the processing and queued tasks acting on a deployment
+func (c *Client) GetRunningTasks(deployment string) ([]Task, error) {
+	var tasks []Task
+	if err := c.get("/tasks?state=processing,queued&deployment="+url.QueryEscape(deployment), &tasks); err != nil {
+		return nil, err
+	}
+	return RunningTasks(tasks, deployment), nil
+}
+
+// wait - polls a task until it finishes, failing if it did not finish successfully or within the task timeout
+func (c *Client) wait(id int) error {
+	deadline := time.Now().Add(c.config.TaskTimeout)
+	for {
+		var task gogobosh.Task
+		if err := c.get("/tasks/"+strconv.Itoa(id), &task); err != nil {
+			return err
+		}
+		switch task.State {
+		case "done":
+			return nil
+		case "error", "cancelled", "timeout":
+			return fmt.Errorf("BOSH task %d finished in state %s: %s", id, task.State, task.Result)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("BOSH task %d was still %s after %s", id, task.State, c.config.TaskTimeout)
+		}
+		time.Sleep(c.config.TaskPollInterval)
+	}
+}
+
+// get - fetches a path of the director and decodes the json answer into out
+func (c *Client) get(path string, out interface{}) error {
+	resp, err := c.request(path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return c.statusError(resp, path)
+	}
+	return decode(resp, path, out)
+}
+
+// request - fetches a path of the director as the configured user or client
+func (c *Client) request(path string) (*http.Response, error) {
+	authorization, err := c.authorization()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", c.base.String()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	return c.httpClient.Do(req)
+}
+
+// statusError - describes an unexpected answer, forgetting the UAA token when the director rejected it
+func (c *Client) statusError(resp *http.Response, path string) error {
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.mutex.Lock()
+		c.token = ""
+		c.mutex.Unlock()
+	}
+	return fmt.Errorf("BOSH answered %s to GET %s", resp.Status, path)
+}
+
+// authorization - the Authorization header for the director, asking the director how it authenticates users the first
+// time and logging in to UAA when it uses UAA and the previous token is about to expire
+func (c *Client) authorization() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return "Bearer " + c.token, nil
+	}
+	if c.authType == "" {
+		info, err := c.GetInfo()
+		if err != nil {
+			return "", err
+		}
+		c.authType = info.UserAuthenication.Type
+		c.uaaURL = info.UserAuthenication.Options.URL
+	}
+	if c.authType != "uaa" {
+		credentials := c.config.Username + ":" + c.config.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)), nil
+	}
+
+	token, expiresIn, err := c.login(c.uaaURL)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expiry = time.Now().Add(expiresIn - tokenMargin)
+	return "Bearer " + c.token, nil
+}
+
+// login - fetches a UAA token with the client credentials grant when a client is configured, or the password grant
+func (c *Client) login(uaaURL string) (string, time.Duration, error) {
+	if uaaURL == "" {
+		return "", 0, fmt.Errorf("BOSH director uses UAA but did not say where it is")
+	}
+	clientID, clientSecret := c.config.ClientID, c.config.ClientSecret
+	form := url.Values{}
+	if clientID != "" {
+		form.Set("grant_type", "client_credentials")
+	} else {
+		clientID, clientSecret = uaaCLIClient, ""
+		form.Set("grant_type", "password")
+		form.Set("username", c.config.Username)
+		form.Set("password", c.config.Password)
+	}
+
+	path := strings.TrimSuffix(uaaURL, "/") + "/oauth/token"
+	req, err := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(clientID, clientSecret)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", 0, fmt.Errorf("UAA answered %s when logging in as %s", resp.Status, clientID)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := decode(resp, "/oauth/token", &token); err != nil {
+		return "", 0, err
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("UAA did not return an access token for %s", clientID)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// decode - decodes a json answer and closes it
+func decode(resp *http.Response, path string, out interface{}) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not parse the answer to %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package bosh_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		director     *httptest.Server
+		mux          *http.ServeMux
+		config       bosh.ClientConfig
+		client       *bosh.Client
+		mutex        sync.Mutex
+		taskPolls    int
+		tokenLogins  int
+		authorized   []string
+		authType     string
+		taskEndState string
+	)
+
+	respond := func(w http.ResponseWriter, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+
+	BeforeEach(func() {
+		taskPolls, tokenLogins, authorized = 0, 0, nil
+		authType, taskEndState = "basic", "done"
+		mux = http.NewServeMux()
+		director = httptest.NewTLSServer(mux)
+		mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+			respond(w, map[string]interface{}{
+				"uuid":                "2daf673a-9755-4b4f-aa6d-3632fbed8019",
+				"user_authentication": map[string]interface{}{"type": authType, "options": map[string]string{"url": director.URL}},
+			})
+		})
+		mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			user, secret, _ := r.BasicAuth()
+			r.ParseForm()
+			mutex.Lock()
+			tokenLogins++
+			mutex.Unlock()
+			if user != "monitor" || secret != "s3cret" || r.Form.Get("grant_type") != "client_credentials" {
+				w.WriteHeader(401)
+				return
+			}
+			respond(w, map[string]interface{}{"access_token": "token-1", "expires_in": 3600})
+		})
+		mux.HandleFunc("/deployments", func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			authorized = append(authorized, r.Header.Get("Authorization"))
+			mutex.Unlock()
+			respond(w, []map[string]string{{"name": "cf-12345"}})
+		})
+		mux.HandleFunc("/deployments/cf-12345/vms", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://10.0.0.6:25555/tasks/5", http.StatusFound)
+		})
+		mux.HandleFunc("/tasks/5", func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			taskPolls++
+			state := "processing"
+			if taskPolls > 1 {
+				state = taskEndState
+			}
+			mutex.Unlock()
+			respond(w, map[string]interface{}{"id": 5, "state": state, "result": "director exploded"})
+		})
+		mux.HandleFunc("/tasks/5/output", func(w http.ResponseWriter, r *http.Request) {
+			Ω(r.URL.Query().Get("type")).Should(Equal("result"))
+			fmt.Fprintln(w, `{"vm_cid":"11","ips":["10.0.16.5"],"job_name":"etcd_server-d284104a9345228c01e2","index":0}`)
+			fmt.Fprintln(w, `{"vm_cid":"12","ips":["10.0.16.6"],"job_name":"etcd_server-d284104a9345228c01e2","index":1}`)
+		})
+		mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+			Ω(r.URL.Query().Get("deployment")).Should(Equal("cf-12345"))
+			respond(w, []bosh.Task{{ID: 6, State: "processing", Deployment: "cf-12345"}})
+		})
+
+		caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: director.TLS.Certificates[0].Certificate[0]})
+		config = bosh.ClientConfig{
+			URI:              director.URL,
+			Username:         "admin",
+			Password:         "hunter2",
+			CACert:           string(caCert),
+			TaskPollInterval: time.Millisecond,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		client, err = bosh.NewClient(config)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		director.Close()
+	})
+
+	It("trusts the director through its CA cert and logs in as the user", func() {
+		deployments, err := client.GetDeployments()
+		Ω(err).Should(BeNil())
+		Ω(deployments).Should(HaveLen(1))
+		Ω(deployments[0].Name).Should(Equal("cf-12345"))
+		Ω(authorized).Should(Equal([]string{"Basic YWRtaW46aHVudGVyMg=="}))
+	})
+
+	It("waits for the task listing the VMs, following the director's redirect to its own address", func() {
+		vms, err := client.GetDeploymentVMs("cf-12345")
+		Ω(err).Should(BeNil())
+		Ω(taskPolls).Should(Equal(2))
+		Ω(vms).Should(HaveLen(2))
+		Ω(vms[1].IPs).Should(Equal([]string{"10.0.16.6"}))
+	})
+
+	It("returns the running tasks of a deployment", func() {
+		tasks, err := client.GetRunningTasks("cf-12345")
+		Ω(err).Should(BeNil())
+		Ω(tasks).Should(HaveLen(1))
+		Ω(tasks[0].ID).Should(Equal(6))
+	})
+
+	Context("when the task listing the VMs fails", func() {
+		BeforeEach(func() {
+			taskEndState = "error"
+		})
+
+		It("returns the task's error", func() {
+			_, err := client.GetDeploymentVMs("cf-12345")
+			Ω(err).Should(MatchError("BOSH task 5 finished in state error: director exploded"))
+		})
+	})
+
+	Context("when the director's cert is not trusted", func() {
+		BeforeEach(func() {
+			config.CACert = ""
+		})
+
+		It("refuses to talk to it", func() {
+			_, err := client.GetDeployments()
+			Ω(err).ShouldNot(BeNil())
+			Ω(authorized).Should(BeEmpty())
+		})
+	})
+
+	Context("when the task listing the VMs never finishes", func() {
+		BeforeEach(func() {
+			taskEndState = "queued"
+			config.TaskTimeout = 20 * time.Millisecond
+		})
+
+		It("gives up once the task timeout has passed", func() {
+			_, err := client.GetDeploymentVMs("cf-12345")
+			Ω(err).Should(MatchError("BOSH task 5 was still queued after 20ms"))
+		})
+	})
+
+	It("rejects a CA cert that is not PEM", func() {
+		config.CACert = "not a cert"
+		_, err := bosh.NewClient(config)
+		Ω(err).Should(MatchError("Could not add director CA Cert, CA Cert was likely invalid"))
+	})
+
+	Context("when the director uses UAA", func() {
+		BeforeEach(func() {
+			authType = "uaa"
+			config.ClientID = "monitor"
+			config.ClientSecret = "s3cret"
+		})
+
+		It("logs in as the UAA client and reuses the token until it expires", func() {
+			_, err := client.GetDeployments()
+			Ω(err).Should(BeNil())
+			_, err = client.GetDeployments()
+			Ω(err).Should(BeNil())
+			Ω(tokenLogins).Should(Equal(1))
+			Ω(authorized).Should(Equal([]string{"Bearer token-1", "Bearer token-1"}))
+		})
+
+		Context("and rejects the client", func() {
+			BeforeEach(func() {
+				config.ClientSecret = "wrong"
+			})
+
+			It("returns the login error", func() {
+				_, err := client.GetDeployments()
+				Ω(err).Should(MatchError("UAA answered 401 Unauthorized when logging in as monitor"))
+			})
+		})
+	})
+})
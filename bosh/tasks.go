@@ -0,0 +1,48 @@
+package bosh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/cloudfoundry-community/gogobosh"
+)
+
+// Task - a BOSH task, which unlike gogobosh.Task includes the deployment it acts on
+type Task struct {
+	ID          int    `json:"id"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Timestamp   int64  `json:"timestamp"`
+	User        string `json:"user"`
+	Deployment  string `json:"deployment"`
+}
+
+// GetRunningTasks - returns the processing and queued tasks acting on a deployment, such as a deploy, recreate, stop or start
+func GetRunningTasks(client *gogobosh.Client, deployment string) ([]Task, error) {
+	request := client.NewRequest("GET", "/tasks?state=processing,queued&deployment="+url.QueryEscape(deployment))
+	resp, err := client.DoRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("BOSH answered %s when listing tasks", resp.Status)
+	}
+	var tasks []Task
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		return nil, err
+	}
+	return RunningTasks(tasks, deployment), nil
+}
+
+// RunningTasks - takes tasks and returns those still processing or queued for the deployment
+func RunningTasks(tasks []Task, deployment string) []Task {
+	var running []Task
+	for _, task := range tasks {
+		if task.Deployment == deployment && (task.State == "processing" || task.State == "queued") {
+			running = append(running, task)
+		}
+	}
+	return running
+}
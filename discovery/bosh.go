@@ -0,0 +1,44 @@
+package discovery
+
+import (
+	"fmt"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+)
+
+// BOSH - the VMs of the etcd job in a BOSH deployment, each reached on its first IP with the same protocol and port.
+// The deployment is found, and its etcd certs read, by the caller, which also labels the cluster with the director.
+type BOSH struct {
+	Director   bosh.Director
+	Deployment string
+	Job        string
+	Protocol   string
+	Port       int
+}
+
+// Discover - lists the deployment's VMs through a BOSH task and keeps those whose job name starts with the job,
+// skipping VMs that BOSH lists without IPs, such as while it recreates them
+func (b BOSH) Discover() ([]Endpoint, error) {
+	fmt.Printf("Fetching the etcd VMs of deployment %s from BOSH...\n", b.Deployment)
+	vms, err := b.Director.GetDeploymentVMs(b.Deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	for _, vm := range bosh.FindVMs(vms, fmt.Sprintf("^%s*", b.Job)) {
+		if len(vm.IPs) == 0 {
+			fmt.Printf("Skipping etcd VM %s/%d of deployment %s, BOSH lists no IPs for it\n", vm.JobName, vm.Index, b.Deployment)
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{
+			Host:     vm.IPs[0],
+			Port:     b.Port,
+			Protocol: b.Protocol,
+			JobName:  vm.JobName,
+			Index:    vm.Index,
+			VMCID:    vm.VMCID,
+		})
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ModeBOSH - etcd VMs are found by matching a BOSH deployment and job
+	ModeBOSH = "bosh"
+	// ModeStatic - etcd endpoints are listed in the config
+	ModeStatic = "static"
+	// ModeDNS - etcd endpoints are the addresses a DNS name resolves to
+	ModeDNS = "dns"
+	// ModeDNSSRV - etcd endpoints are the targets of the etcd client SRV records of a domain
+	ModeDNSSRV = "dns-srv"
+	// ModeMembers - etcd endpoints are the client URLs of the members listed by a seed endpoint
+	ModeMembers = "members"
+)
+
+const (
+	// srvService - the SRV service of etcd client endpoints served over http, as used by etcd's own DNS discovery
+	srvService = "etcd-client"
+	// srvServiceSSL - the SRV service of etcd client endpoints served over https
+	srvServiceSSL = "etcd-client-ssl"
+)
+
+// Endpoint - an etcd node to probe. Nodes found through BOSH also carry their job, index and VM CID.
+type Endpoint struct {
+	Host     string
+	Port     int
+	Protocol string
+	JobName  string
+	Index    int
+	VMCID    string
+}
+
+// URL - the client URL of the endpoint
+func (e Endpoint) URL() string {
+	return fmt.Sprintf("%s://%s", e.Protocol, net.JoinHostPort(e.Host, strconv.Itoa(e.Port)))
+}
+
+// Discoverer - finds the etcd endpoints of a cluster
+type Discoverer interface {
+	Discover() ([]Endpoint, error)
+}
+
+// Resolver - the DNS lookups discovery needs
+type Resolver interface {
+	LookupHost(host string) ([]string, error)
+	LookupSRV(service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SystemResolver - resolves names through the system's resolver
+type SystemResolver struct{}
+
+// LookupHost - returns the addresses of a host
+func (SystemResolver) LookupHost(host string) ([]string, error) {
+	return net.LookupHost(host)
+}
+
+// LookupSRV - returns the SRV records of a service
+func (SystemResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	return net.LookupSRV(service, proto, name)
+}
+
+// Static - a fixed list of endpoints, each a URL such as https://10.0.0.5:2379 or a host with an optional port,
+// which is reached with the default protocol and port
+type Static struct {
+	Endpoints []string
+	Protocol  string
+	Port      int
+}
+
+// Discover - returns the listed endpoints
+func (s Static) Discover() ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for i, raw := range s.Endpoints {
+		endpoint, err := ParseEndpoint(raw, s.Protocol, s.Port)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Index = i
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd endpoints are configured")
+	}
+	return endpoints, nil
+}
+
+// ParseEndpoint - parses a URL such as https://10.0.0.5:2379, or a host with an optional port which is reached with
+// the default protocol and port
+func ParseEndpoint(raw string, protocol string, port int) (Endpoint, error) {
+	raw = strings.TrimSpace(raw)
+	host := raw
+	if strings.Contains(raw, "://") {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("endpoint %q is not a valid URL: %v", raw, err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return Endpoint{}, fmt.Errorf("endpoint %q must use http or https", raw)
+		}
+		protocol = parsed.Scheme
+		host = parsed.Host
+	}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		parsedPort, err := strconv.Atoi(p)
+		if err != nil || parsedPort < 1 || parsedPort > 65535 {
+			return Endpoint{}, fmt.Errorf("endpoint %q has an invalid port", raw)
+		}
+		host, port = h, parsedPort
+	}
+	if host == "" {
+		return Endpoint{}, fmt.Errorf("endpoint %q has no host", raw)
+	}
+	return Endpoint{Host: host, Port: port, Protocol: protocol}, nil
+}
+
+// DNS - the addresses a name resolves to, each reached with the same protocol and port
+type DNS struct {
+	Name     string
+	Protocol string
+	Port     int
+	Resolver Resolver
+}
+
+// Discover - resolves the name, ordering the addresses so each keeps its index between discoveries
+func (d DNS) Discover() ([]Endpoint, error) {
+	addresses, err := d.Resolver.LookupHost(d.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s resolved to no addresses", d.Name)
+	}
+	sort.Strings(addresses)
+
+	var endpoints []Endpoint
+	for i, address := range addresses {
+		endpoints = append(endpoints, Endpoint{Host: address, Port: d.Port, Protocol: d.Protocol, Index: i})
+	}
+	return endpoints, nil
+}
+
+// SRV - the targets of a domain's _etcd-client-ssl._tcp records, reached over https, and _etcd-client._tcp records,
+// reached over http, as etcd itself discovers its client endpoints
+type SRV struct {
+	Domain   string
+	Resolver Resolver
+}
+
+// Discover - looks up both services, succeeding when either has records, and orders the targets so each keeps its
+// index between discoveries
+func (s SRV) Discover() ([]Endpoint, error) {
+	var (
+		endpoints []Endpoint
+		failures  []string
+	)
+	for _, service := range []struct{ name, protocol string }{{srvServiceSSL, "https"}, {srvService, "http"}} {
+		_, records, err := s.Resolver.LookupSRV(service.name, "tcp", s.Domain)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		for _, record := range records {
+			endpoints = append(endpoints, Endpoint{
+				Host:     strings.TrimSuffix(record.Target, "."),
+				Port:     int(record.Port),
+				Protocol: service.protocol,
+			})
+		}
+	}
+	if len(endpoints) == 0 {
+		if len(failures) > 0 {
+			return nil, fmt.Errorf("could not find etcd client SRV records for %s: %s", s.Domain, strings.Join(failures, "; "))
+		}
+		return nil, fmt.Errorf("could not find etcd client SRV records for %s", s.Domain)
+	}
+	sort.Sort(byURL(endpoints))
+	for i := range endpoints {
+		endpoints[i].Index = i
+	}
+	return endpoints, nil
+}
+
+type byURL []Endpoint
+
+func (e byURL) Len() int           { return len(e) }
+func (e byURL) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byURL) Less(i, j int) bool { return e[i].URL() < e[j].URL() }
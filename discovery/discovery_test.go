@@ -0,0 +1,224 @@
+package discovery_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+	"github.com/FidelityInternational/etcd-leader-monitor/discovery"
+	"github.com/cloudfoundry-community/gogobosh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeResolver struct {
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (f fakeResolver) LookupHost(host string) ([]string, error) {
+	addresses, ok := f.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+	return addresses, nil
+}
+
+func (f fakeResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	cname := fmt.Sprintf("_%s._%s.%s", service, proto, name)
+	records, ok := f.srvs[cname]
+	if !ok {
+		return "", nil, fmt.Errorf("lookup %s: no such host", cname)
+	}
+	return cname, records, nil
+}
+
+type fakeDirector struct {
+	bosh.Director
+	vms map[string][]gogobosh.VM
+}
+
+func (f fakeDirector) GetDeploymentVMs(name string) ([]gogobosh.VM, error) {
+	vms, ok := f.vms[name]
+	if !ok {
+		return nil, fmt.Errorf("deployment %s not found", name)
+	}
+	return vms, nil
+}
+
+var _ = Describe("#Static", func() {
+	It("reads URLs and hosts, reaching bare hosts with the default protocol and port", func() {
+		endpoints, err := discovery.Static{
+			Endpoints: []string{"https://etcd-0.example.com:2379", "10.0.0.6", "10.0.0.7:4002"},
+			Protocol:  "http",
+			Port:      4001,
+		}.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(Equal([]discovery.Endpoint{
+			{Host: "etcd-0.example.com", Port: 2379, Protocol: "https", Index: 0},
+			{Host: "10.0.0.6", Port: 4001, Protocol: "http", Index: 1},
+			{Host: "10.0.0.7", Port: 4002, Protocol: "http", Index: 2},
+		}))
+		Ω(endpoints[0].URL()).Should(Equal("https://etcd-0.example.com:2379"))
+	})
+
+	It("rejects endpoints that cannot be reached", func() {
+		_, err := discovery.Static{Endpoints: []string{"ftp://10.0.0.5"}}.Discover()
+		Ω(err).Should(MatchError(`endpoint "ftp://10.0.0.5" must use http or https`))
+		_, err = discovery.Static{Endpoints: []string{"10.0.0.5:http"}}.Discover()
+		Ω(err).Should(MatchError(`endpoint "10.0.0.5:http" has an invalid port`))
+		_, err = discovery.Static{}.Discover()
+		Ω(err).Should(MatchError("no etcd endpoints are configured"))
+	})
+})
+
+var _ = Describe("#DNS", func() {
+	resolver := fakeResolver{hosts: map[string][]string{"etcd.example.com": {"10.0.0.7", "10.0.0.5", "10.0.0.6"}}}
+
+	It("probes every address the name resolves to, in a stable order", func() {
+		endpoints, err := discovery.DNS{Name: "etcd.example.com", Protocol: "https", Port: 2379, Resolver: resolver}.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(HaveLen(3))
+		Ω(endpoints[0]).Should(Equal(discovery.Endpoint{Host: "10.0.0.5", Port: 2379, Protocol: "https", Index: 0}))
+		Ω(endpoints[2].Host).Should(Equal("10.0.0.7"))
+	})
+
+	It("returns the lookup error", func() {
+		_, err := discovery.DNS{Name: "missing.example.com", Resolver: resolver}.Discover()
+		Ω(err).Should(MatchError("lookup missing.example.com: no such host"))
+	})
+})
+
+var _ = Describe("#SRV", func() {
+	It("combines the https and http client records, as etcd does", func() {
+		resolver := fakeResolver{srvs: map[string][]*net.SRV{
+			"_etcd-client-ssl._tcp.example.com": {
+				{Target: "etcd-1.example.com.", Port: 2379},
+				{Target: "etcd-0.example.com.", Port: 2379},
+			},
+			"_etcd-client._tcp.example.com": {
+				{Target: "etcd-2.example.com.", Port: 4001},
+			},
+		}}
+		endpoints, err := discovery.SRV{Domain: "example.com", Resolver: resolver}.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(Equal([]discovery.Endpoint{
+			{Host: "etcd-2.example.com", Port: 4001, Protocol: "http", Index: 0},
+			{Host: "etcd-0.example.com", Port: 2379, Protocol: "https", Index: 1},
+			{Host: "etcd-1.example.com", Port: 2379, Protocol: "https", Index: 2},
+		}))
+	})
+
+	It("succeeds when only one of the services has records", func() {
+		resolver := fakeResolver{srvs: map[string][]*net.SRV{
+			"_etcd-client._tcp.example.com": {{Target: "etcd-0.example.com.", Port: 4001}},
+		}}
+		endpoints, err := discovery.SRV{Domain: "example.com", Resolver: resolver}.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(HaveLen(1))
+	})
+
+	It("fails when neither service has records", func() {
+		_, err := discovery.SRV{Domain: "example.com", Resolver: fakeResolver{}}.Discover()
+		Ω(err).Should(MatchError("could not find etcd client SRV records for example.com: " +
+			"lookup _etcd-client-ssl._tcp.example.com: no such host; lookup _etcd-client._tcp.example.com: no such host"))
+	})
+})
+
+var _ = Describe("#BOSH", func() {
+	director := fakeDirector{vms: map[string][]gogobosh.VM{
+		"cf-warden": {
+			{JobName: "etcd_z1", Index: 0, IPs: []string{"10.0.16.4"}, VMCID: "vm-a"},
+			{JobName: "api_z1", Index: 0, IPs: []string{"10.0.16.9"}, VMCID: "vm-b"},
+			{JobName: "etcd_z2", Index: 1, IPs: []string{"10.0.32.4", "10.0.32.5"}, VMCID: "vm-c"},
+			{JobName: "etcd_z2", Index: 2, VMCID: "vm-d"},
+		},
+	}}
+
+	It("reaches the etcd job's VMs on their first IP, skipping those BOSH lists without IPs", func() {
+		endpoints, err := discovery.BOSH{Director: director, Deployment: "cf-warden", Job: "etcd", Protocol: "https", Port: 4001}.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(Equal([]discovery.Endpoint{
+			{Host: "10.0.16.4", Port: 4001, Protocol: "https", JobName: "etcd_z1", Index: 0, VMCID: "vm-a"},
+			{Host: "10.0.32.4", Port: 4001, Protocol: "https", JobName: "etcd_z2", Index: 1, VMCID: "vm-c"},
+		}))
+	})
+
+	It("returns the error of the director", func() {
+		_, err := discovery.BOSH{Director: director, Deployment: "cf", Job: "etcd"}.Discover()
+		Ω(err).Should(MatchError("deployment cf not found"))
+	})
+})
+
+var _ = Describe("#Members", func() {
+	var (
+		seed     *httptest.Server
+		down     *httptest.Server
+		version  string
+		members  discovery.Members
+		requests []string
+	)
+
+	BeforeEach(func() {
+		version, requests = "2.3.8", nil
+		seed = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			switch r.URL.Path {
+			case "/version":
+				fmt.Fprintf(w, `{"etcdserver":"%s","etcdcluster":"%s"}`, version, version)
+			case "/v2/members":
+				fmt.Fprintln(w, `{"members":[`+
+					`{"id":"a","name":"etcd-1","clientURLs":["http://127.0.0.1:4001","http://10.0.0.6:4001"]},`+
+					`{"id":"b","name":"etcd-0","clientURLs":["http://10.0.0.5:4001"]},`+
+					`{"id":"c","name":"etcd-2","clientURLs":[]}]}`)
+			case "/v3/cluster/member/list":
+				fmt.Fprintln(w, `{"members":[{"ID":"10","name":"etcd-0","clientURLs":["https://etcd-0.example.com:2379"]}]}`)
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+		down = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(503)
+		}))
+		members = discovery.Members{
+			Seeds:      []string{down.URL, seed.URL},
+			Protocol:   "http",
+			Port:       4001,
+			API:        "auto",
+			HTTPClient: &http.Client{},
+			Timeout:    time.Second,
+		}
+	})
+
+	AfterEach(func() {
+		seed.Close()
+		down.Close()
+	})
+
+	It("lists the members through the first seed that answers, skipping loopback and missing client URLs", func() {
+		endpoints, err := members.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(Equal([]discovery.Endpoint{
+			{Host: "10.0.0.5", Port: 4001, Protocol: "http", Index: 0},
+			{Host: "10.0.0.6", Port: 4001, Protocol: "http", Index: 1},
+		}))
+		Ω(requests).Should(Equal([]string{"/version", "/v2/members"}))
+	})
+
+	It("lists the members through the v3 gateway of etcd 3.4 and later", func() {
+		version = "3.4.3"
+		endpoints, err := members.Discover()
+		Ω(err).Should(BeNil())
+		Ω(endpoints).Should(Equal([]discovery.Endpoint{{Host: "etcd-0.example.com", Port: 2379, Protocol: "https", Index: 0}}))
+	})
+
+	It("fails when no seed answers", func() {
+		members.Seeds = []string{down.URL}
+		members.API = "v2"
+		_, err := members.Discover()
+		Ω(err).Should(MatchError(fmt.Sprintf("could not list the etcd members through any seed: %s: unexpected end of JSON input", down.URL)))
+	})
+})
@@ -0,0 +1,112 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/etcd"
+)
+
+// Members - the client URLs of every member of the cluster, as listed by the first seed endpoint that answers. This
+// finds members that were added outside BOSH or whose VMs no longer match the configured job.
+type Members struct {
+	Seeds      []string
+	Protocol   string
+	Port       int
+	API        string
+	HTTPClient *http.Client
+	Timeout    time.Duration
+}
+
+// Discover - asks each seed in turn for the cluster's members, through the v2 members API or the v3 gateway, and
+// orders the members so each keeps its index between discoveries
+func (m Members) Discover() ([]Endpoint, error) {
+	seeds, err := Static{Endpoints: m.Seeds, Protocol: m.Protocol, Port: m.Port}.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []string
+	for _, seed := range seeds {
+		members, err := m.members(seed)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", seed.URL(), err))
+			continue
+		}
+		return m.endpoints(members)
+	}
+	return nil, fmt.Errorf("could not list the etcd members through any seed: %s", strings.Join(failures, "; "))
+}
+
+// members - lists the members a seed knows of, detecting the seed's API first in auto mode
+func (m Members) members(seed Endpoint) ([]etcd.Member, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+
+	etcdClient := etcd.NewClient(&etcd.Config{
+		EtcdIP:       seed.Host,
+		EtcdPort:     seed.Port,
+		HTTPClient:   m.HTTPClient,
+		EtcdProtocol: seed.Protocol,
+	})
+	api := m.API
+	if api == etcd.APIAuto {
+		detected, err := etcdClient.DetectAPI(ctx)
+		if err != nil {
+			detected = etcd.APIv2
+		}
+		api = detected
+	}
+	if api == etcd.APIv3 {
+		return etcdClient.GetMemberList(ctx)
+	}
+	return etcdClient.GetMembers(ctx)
+}
+
+// endpoints - the client URL of each member, preferring one that is reachable from outside the member's VM. Members
+// that have not started yet have no client URLs and are left to the membership checks to report.
+func (m Members) endpoints(members []etcd.Member) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, member := range members {
+		clientURL := ""
+		for _, candidate := range member.ClientURLs {
+			if clientURL == "" || (isLoopback(clientURL, m.Protocol, m.Port) && !isLoopback(candidate, m.Protocol, m.Port)) {
+				clientURL = candidate
+			}
+		}
+		if clientURL == "" {
+			continue
+		}
+		endpoint, err := ParseEndpoint(clientURL, m.Protocol, m.Port)
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %v", member.Name, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd member lists a client URL")
+	}
+	sort.Sort(byURL(endpoints))
+	for i := range endpoints {
+		endpoints[i].Index = i
+	}
+	return endpoints, nil
+}
+
+// isLoopback - whether a client URL only accepts connections from the member's own VM
+func isLoopback(raw string, protocol string, port int) bool {
+	endpoint, err := ParseEndpoint(raw, protocol, port)
+	if err != nil {
+		return false
+	}
+	if endpoint.Host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(endpoint.Host)
+	return ip != nil && ip.IsLoopback()
+}
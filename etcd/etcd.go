@@ -1,15 +1,48 @@
 package etcd
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
+const (
+	// ReasonTimeout - the node did not answer before the deadline
+	ReasonTimeout = "timeout"
+	// ReasonConnectionRefused - the node actively refused the connection
+	ReasonConnectionRefused = "connection_refused"
+	// ReasonInvalidResponse - the node answered with something that could not be parsed
+	ReasonInvalidResponse = "invalid_response"
+	// ReasonUnknown - any other probe failure
+	ReasonUnknown = "unknown"
+)
+
+const (
+	// APIv2 - probe nodes through the v2 stats and members endpoints
+	APIv2 = "v2"
+	// APIv3 - probe nodes through the v3 JSON gateway
+	APIv3 = "v3"
+	// APIAuto - pick the API for each node from the version it reports
+	APIAuto = "auto"
+)
+
+// DefaultPort - the client port of the etcd BOSH release, used when no port is configured
+const DefaultPort = 4001
+
 // Config - used for configration of Client
 type Config struct {
 	EtcdIP       string
+	EtcdPort     int
 	HTTPClient   *http.Client
 	EtcdProtocol string
 }
@@ -19,10 +52,109 @@ type Client struct {
 	Config *Config
 }
 
-type etcdLeader struct {
-	Message   string              `json:"message"`
-	Leader    string              `json:"leader"`
-	Followers map[string]struct{} `json:"followers"`
+// LeaderStats - the /v2/stats/leader response, only populated when the node is the leader
+type LeaderStats struct {
+	Message   string                   `json:"message"`
+	Leader    string                   `json:"leader"`
+	Followers map[string]FollowerStats `json:"followers"`
+}
+
+// FollowerStats - the leader's view of a single follower
+type FollowerStats struct {
+	Latency FollowerLatency `json:"latency"`
+	Counts  FollowerCounts  `json:"counts"`
+}
+
+// FollowerLatency - round trip latency in milliseconds from the leader to a follower
+type FollowerLatency struct {
+	Current           float64 `json:"current"`
+	Average           float64 `json:"average"`
+	StandardDeviation float64 `json:"standardDeviation"`
+	Minimum           float64 `json:"minimum"`
+	Maximum           float64 `json:"maximum"`
+}
+
+// FollowerCounts - the number of successful and failed raft messages sent from the leader to a follower
+type FollowerCounts struct {
+	Fail    uint64 `json:"fail"`
+	Success uint64 `json:"success"`
+}
+
+// SelfStats - the /v2/stats/self response
+type SelfStats struct {
+	Name       string     `json:"name"`
+	ID         string     `json:"id"`
+	State      string     `json:"state"`
+	LeaderInfo LeaderInfo `json:"leaderInfo"`
+}
+
+// LeaderInfo - the leader a node believes in
+type LeaderInfo struct {
+	Leader    string `json:"leader"`
+	Uptime    string `json:"uptime"`
+	StartTime string `json:"startTime"`
+}
+
+// Member - a single entry of the /v2/members response
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+}
+
+// Version - the /version response
+type Version struct {
+	Server  string `json:"etcdserver"`
+	Cluster string `json:"etcdcluster"`
+}
+
+// Status - the v3 /v3/maintenance/status response, the gateway encodes 64 bit integers as strings
+type Status struct {
+	Header    ResponseHeader `json:"header"`
+	Version   string         `json:"version"`
+	DBSize    uint64         `json:"dbSize,string"`
+	Leader    uint64         `json:"leader,string"`
+	RaftIndex uint64         `json:"raftIndex,string"`
+	RaftTerm  uint64         `json:"raftTerm,string"`
+	// RaftAppliedIndex - only reported from etcd 3.4
+	RaftAppliedIndex uint64   `json:"raftAppliedIndex,string"`
+	Errors           []string `json:"errors"`
+}
+
+// RaftStatus - the raft position a v2 node reports in the X-Raft-Term and X-Raft-Index headers, zero when not reported
+type RaftStatus struct {
+	Term  uint64
+	Index uint64
+}
+
+// ResponseHeader - the header included in every v3 response
+type ResponseHeader struct {
+	ClusterID uint64 `json:"cluster_id,string"`
+	MemberID  uint64 `json:"member_id,string"`
+	Revision  int64  `json:"revision,string"`
+	RaftTerm  uint64 `json:"raft_term,string"`
+}
+
+// IsLeader - returns true when the node answering is the leader
+func (s Status) IsLeader() bool {
+	return s.Leader != 0 && s.Leader == s.Header.MemberID
+}
+
+// v3Member - a single entry of the v3 member list, identified by a decimal ID
+type v3Member struct {
+	ID         uint64   `json:"ID,string"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+}
+
+// MemberID - formats a v3 member ID the way the v2 API reports it
+func MemberID(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 16)
 }
 
 // NewClient - returns a new client
@@ -30,21 +162,185 @@ func NewClient(config *Config) *Client {
 	return &Client{Config: config}
 }
 
-// GetLeaderStats - returns leader true/false and count of followers
-func (c *Client) GetLeaderStats() (bool, int, error) {
-	var etcdLeader etcdLeader
-	resp, err := c.Config.HTTPClient.Get(fmt.Sprintf("%s://%s:4001/v2/stats/leader", c.Config.EtcdProtocol, c.Config.EtcdIP))
+// IsLeader - returns true when the node reported itself as the leader
+func (l LeaderStats) IsLeader() bool {
+	return l.Leader != ""
+}
+
+// GetLeaderStats - returns the leader stats of the node, including every follower when it is the leader
+func (c *Client) GetLeaderStats(ctx context.Context) (LeaderStats, error) {
+	var leaderStats LeaderStats
+	if err := c.get(ctx, "/v2/stats/leader", &leaderStats); err != nil {
+		return LeaderStats{}, err
+	}
+	return leaderStats, nil
+}
+
+// GetSelfStats - returns the node's own view of its identity, raft state and who it believes is leader
+func (c *Client) GetSelfStats(ctx context.Context) (SelfStats, error) {
+	var selfStats SelfStats
+	if err := c.get(ctx, "/v2/stats/self", &selfStats); err != nil {
+		return SelfStats{}, err
+	}
+	return selfStats, nil
+}
+
+// GetMembers - returns the cluster membership as seen by the node
+func (c *Client) GetMembers(ctx context.Context) ([]Member, error) {
+	var members struct {
+		Members []Member `json:"members"`
+	}
+	if err := c.get(ctx, "/v2/members", &members); err != nil {
+		return nil, err
+	}
+	return members.Members, nil
+}
+
+// GetRaftStatus - returns the raft term and index of a v2 node, the v2 stats endpoints do not expose them
+// so they are read from the headers of a HEAD request for the root key
+func (c *Client) GetRaftStatus(ctx context.Context) (RaftStatus, error) {
+	req, err := http.NewRequest("HEAD", c.url("/v2/keys/"), nil)
+	if err != nil {
+		return RaftStatus{}, err
+	}
+	resp, err := c.Config.HTTPClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return false, 0, err
+		return RaftStatus{}, err
+	}
+	resp.Body.Close()
+	term, _ := strconv.ParseUint(resp.Header.Get("X-Raft-Term"), 10, 64)
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Raft-Index"), 10, 64)
+	return RaftStatus{Term: term, Index: index}, nil
+}
+
+// GetVersion - returns the server and cluster versions the node reports
+func (c *Client) GetVersion(ctx context.Context) (Version, error) {
+	var version Version
+	if err := c.get(ctx, "/version", &version); err != nil {
+		return Version{}, err
+	}
+	return version, nil
+}
+
+// DetectAPI - picks the API to probe the node with, the v3 gateway is only served under /v3 from etcd 3.4
+func (c *Client) DetectAPI(ctx context.Context) (string, error) {
+	version, err := c.GetVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if version.Server == "" {
+		return "", fmt.Errorf("etcd %s did not report a server version", c.Config.EtcdIP)
+	}
+	parts := strings.SplitN(version.Server, ".", 3)
+	major, _ := strconv.Atoi(parts[0])
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	if major > 3 || (major == 3 && minor >= 4) {
+		return APIv3, nil
+	}
+	return APIv2, nil
+}
+
+// GetStatus - returns the node's v3 maintenance status, including the leader it believes in and its raft position
+func (c *Client) GetStatus(ctx context.Context) (Status, error) {
+	var status Status
+	if err := c.post(ctx, "/v3/maintenance/status", &status); err != nil {
+		return Status{}, err
+	}
+	return status, nil
+}
+
+// GetMemberList - returns the cluster membership as seen by the node through the v3 API
+func (c *Client) GetMemberList(ctx context.Context) ([]Member, error) {
+	var response struct {
+		Members []v3Member `json:"members"`
+	}
+	if err := c.post(ctx, "/v3/cluster/member/list", &response); err != nil {
+		return nil, err
+	}
+	members := []Member{}
+	for _, member := range response.Members {
+		members = append(members, Member{
+			ID:         MemberID(member.ID),
+			Name:       member.Name,
+			PeerURLs:   member.PeerURLs,
+			ClientURLs: member.ClientURLs,
+		})
+	}
+	return members, nil
+}
+
+// url - the URL of a path on the node's client port
+func (c *Client) url(path string) string {
+	port := c.Config.EtcdPort
+	if port == 0 {
+		port = DefaultPort
+	}
+	return fmt.Sprintf("%s://%s%s", c.Config.EtcdProtocol, net.JoinHostPort(c.Config.EtcdIP, strconv.Itoa(port)), path)
+}
+
+// get - fetches a path from the node's client port and unmarshals the json response
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, "GET", path, nil, out)
+}
+
+// post - sends an empty json request to a v3 gateway path and unmarshals the json response
+func (c *Client) post(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, "POST", path, bytes.NewBufferString("{}"), out)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.url(path), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Config.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 	data, err := ioutil.ReadAll(resp.Body)
-	err = json.Unmarshal(data, &etcdLeader)
 	if err != nil {
-		return false, 0, err
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// ErrorReason - classifies a probe error so timeouts can be told apart from refused connections
+func ErrorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if err == context.DeadlineExceeded {
+		return ReasonTimeout
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		if urlErr.Err == context.DeadlineExceeded || urlErr.Timeout() {
+			return ReasonTimeout
+		}
+		err = urlErr.Err
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return ReasonTimeout
+	}
+	for {
+		opErr, ok := err.(*net.OpError)
+		if !ok {
+			break
+		}
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok && sysErr.Err == syscall.ECONNREFUSED {
+		return ReasonConnectionRefused
 	}
-	if etcdLeader.Leader != "" {
-		return true, len(etcdLeader.Followers), nil
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return ReasonInvalidResponse
 	}
-	return false, 0, nil
+	return ReasonUnknown
 }
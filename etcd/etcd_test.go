@@ -1,11 +1,13 @@
 package etcd_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"time"
 
 	"github.com/FidelityInternational/etcd-leader-monitor/etcd"
 	. "github.com/onsi/ginkgo"
@@ -29,17 +31,65 @@ var _ = Describe("#GetLeaderStats", func() {
 		var client *etcd.Client
 
 		BeforeEach(func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Close()
+
+			transport := &http.Transport{
+				Proxy: func(req *http.Request) (*url.URL, error) {
+					return url.Parse(server.URL)
+				},
+			}
 			config := &etcd.Config{
-				EtcdIP:       "1.1.1.1:1",
-				HTTPClient:   &http.Client{},
+				EtcdIP:       "1.1.1.1",
+				HTTPClient:   &http.Client{Transport: transport},
 				EtcdProtocol: "http",
 			}
 			client = etcd.NewClient(config)
 		})
 
 		It("returns the error", func() {
-			_, _, err := client.GetLeaderStats()
-			Ω(err).Should(Or(MatchError(`Get http://1.1.1.1:1:4001/v2/stats/leader: dial tcp: too many colons in address 1.1.1.1:1:4001`), MatchError(`Get http://1.1.1.1:1:4001/v2/stats/leader: invalid URL port "1:4001"`)))
+			_, err := client.GetLeaderStats(context.Background())
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("connection refused"))
+			Ω(etcd.ErrorReason(err)).Should(Equal(etcd.ReasonConnectionRefused))
+		})
+	})
+
+	Context("when the node does not answer before the context deadline", func() {
+		var (
+			client  *etcd.Client
+			release chan struct{}
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+
+			transport := &http.Transport{
+				Proxy: func(req *http.Request) (*url.URL, error) {
+					return url.Parse(server.URL)
+				},
+			}
+			config := &etcd.Config{
+				EtcdIP:       "1.1.1.1",
+				HTTPClient:   &http.Client{Transport: transport},
+				EtcdProtocol: "http",
+			}
+			client = etcd.NewClient(config)
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("returns a timeout error", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err := client.GetLeaderStats(ctx)
+			Ω(err).Should(HaveOccurred())
+			Ω(etcd.ErrorReason(err)).Should(Equal(etcd.ReasonTimeout))
 		})
 	})
 
@@ -70,8 +120,9 @@ var _ = Describe("#GetLeaderStats", func() {
 		})
 
 		It("returns the error", func() {
-			_, _, err := client.GetLeaderStats()
+			_, err := client.GetLeaderStats(context.Background())
 			Ω(err).Should(MatchError("invalid character 'l' looking for beginning of value"))
+			Ω(etcd.ErrorReason(err)).Should(Equal(etcd.ReasonInvalidResponse))
 		})
 	})
 
@@ -102,10 +153,22 @@ var _ = Describe("#GetLeaderStats", func() {
 				client = etcd.NewClient(config)
 			})
 
-			It("returns a count of followers and leader true", func() {
-				leader, followers, _ := client.GetLeaderStats()
-				Ω(leader).Should(BeTrue())
-				Ω(followers).Should(Equal(2))
+			It("returns leader true and the stats of every follower", func() {
+				stats, err := client.GetLeaderStats(context.Background())
+				Ω(err).Should(BeNil())
+				Ω(stats.IsLeader()).Should(BeTrue())
+				Ω(stats.Leader).Should(Equal("6a0b69a54415a491"))
+				Ω(stats.Followers).Should(HaveLen(2))
+				Ω(stats.Followers["a0294459200078aa"]).Should(Equal(etcd.FollowerStats{
+					Latency: etcd.FollowerLatency{
+						Current:           0.001199,
+						Average:           0.0023682517720168754,
+						StandardDeviation: 0.4302199179552562,
+						Minimum:           0.000654,
+						Maximum:           1996.564157,
+					},
+					Counts: etcd.FollowerCounts{Fail: 16, Success: 21538911},
+				}))
 			})
 		})
 
@@ -136,9 +199,261 @@ var _ = Describe("#GetLeaderStats", func() {
 			})
 
 			It("returns leader false", func() {
-				leader, _, _ := client.GetLeaderStats()
-				Ω(leader).Should(BeFalse())
+				stats, _ := client.GetLeaderStats(context.Background())
+				Ω(stats.IsLeader()).Should(BeFalse())
+				Ω(stats.Message).Should(Equal("not current leader"))
 			})
 		})
 	})
 })
+
+var _ = Describe("#ErrorReason", func() {
+	It("returns an empty reason for no error", func() {
+		Ω(etcd.ErrorReason(nil)).Should(BeEmpty())
+	})
+
+	It("classifies a context deadline as a timeout", func() {
+		Ω(etcd.ErrorReason(context.DeadlineExceeded)).Should(Equal(etcd.ReasonTimeout))
+	})
+
+	It("classifies anything else as unknown", func() {
+		Ω(etcd.ErrorReason(fmt.Errorf("something else"))).Should(Equal(etcd.ReasonUnknown))
+	})
+})
+
+var _ = Describe("#GetSelfStats", func() {
+	var client *etcd.Client
+
+	BeforeEach(func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.String() != "http://1.1.1.1:4001/v2/stats/self" {
+				w.WriteHeader(404)
+				return
+			}
+			w.WriteHeader(200)
+			fmt.Fprintln(w, `{"name":"etcd-1","id":"a0294459200078aa","state":"StateFollower","startTime":"2016-10-19T14:29:32.105829581Z","leaderInfo":{"leader":"6a0b69a54415a491","uptime":"1h2m3s","startTime":"2016-10-19T14:29:33.105829581Z"},"recvAppendRequestCnt":1024,"sendAppendRequestCnt":0}`)
+		}))
+
+		transport := &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				return url.Parse(server.URL)
+			},
+		}
+		client = etcd.NewClient(&etcd.Config{
+			EtcdIP:       "1.1.1.1",
+			HTTPClient:   &http.Client{Transport: transport},
+			EtcdProtocol: "http",
+		})
+	})
+
+	It("returns the node's identity, state and the leader it believes in", func() {
+		stats, err := client.GetSelfStats(context.Background())
+		Ω(err).Should(BeNil())
+		Ω(stats.Name).Should(Equal("etcd-1"))
+		Ω(stats.ID).Should(Equal("a0294459200078aa"))
+		Ω(stats.State).Should(Equal("StateFollower"))
+		Ω(stats.LeaderInfo.Leader).Should(Equal("6a0b69a54415a491"))
+		Ω(stats.LeaderInfo.Uptime).Should(Equal("1h2m3s"))
+	})
+})
+
+var _ = Describe("#GetVersion", func() {
+	It("reaches the node on the configured client port", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.String() != "http://etcd-0.example.com:2379/version" {
+				w.WriteHeader(404)
+				return
+			}
+			fmt.Fprintln(w, `{"etcdserver":"3.4.9","etcdcluster":"3.4.0"}`)
+		}))
+		defer server.Close()
+
+		client := etcd.NewClient(&etcd.Config{
+			EtcdIP:       "etcd-0.example.com",
+			EtcdPort:     2379,
+			EtcdProtocol: "http",
+			HTTPClient: &http.Client{Transport: &http.Transport{
+				Proxy: func(req *http.Request) (*url.URL, error) {
+					return url.Parse(server.URL)
+				},
+			}},
+		})
+		version, err := client.GetVersion(context.Background())
+		Ω(err).Should(BeNil())
+		Ω(version.Server).Should(Equal("3.4.9"))
+	})
+})
+
+var _ = Describe("#GetMembers", func() {
+	var (
+		client  *etcd.Client
+		members []etcd.Member
+		err     error
+	)
+
+	BeforeEach(func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.String() != "http://1.1.1.1:4001/v2/members" {
+				w.WriteHeader(404)
+				return
+			}
+			w.WriteHeader(200)
+			fmt.Fprintln(w, `{"members":[{"id":"6a0b69a54415a491","name":"etcd-0","peerURLs":["http://1.1.1.1:7001"],"clientURLs":["http://1.1.1.1:4001"]},{"id":"a0294459200078aa","name":"etcd-1","peerURLs":["http://2.2.2.2:7001"],"clientURLs":["http://2.2.2.2:4001"]}]}`)
+		}))
+
+		transport := &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				return url.Parse(server.URL)
+			},
+		}
+		client = etcd.NewClient(&etcd.Config{
+			EtcdIP:       "1.1.1.1",
+			HTTPClient:   &http.Client{Transport: transport},
+			EtcdProtocol: "http",
+		})
+		members, err = client.GetMembers(context.Background())
+	})
+
+	It("returns every member with its peer and client URLs", func() {
+		Ω(err).Should(BeNil())
+		Ω(members).Should(Equal([]etcd.Member{
+			{ID: "6a0b69a54415a491", Name: "etcd-0", PeerURLs: []string{"http://1.1.1.1:7001"}, ClientURLs: []string{"http://1.1.1.1:4001"}},
+			{ID: "a0294459200078aa", Name: "etcd-1", PeerURLs: []string{"http://2.2.2.2:7001"}, ClientURLs: []string{"http://2.2.2.2:4001"}},
+		}))
+	})
+})
+
+var _ = Describe("v3 API", func() {
+	var (
+		client   *etcd.Client
+		handlers map[string]string
+		methods  map[string]string
+	)
+
+	BeforeEach(func() {
+		handlers = map[string]string{}
+		methods = map[string]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			methods[r.URL.Path] = r.Method
+			body, ok := handlers[r.URL.Path]
+			if !ok {
+				w.WriteHeader(404)
+				return
+			}
+			w.WriteHeader(200)
+			fmt.Fprintln(w, body)
+		}))
+
+		transport := &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				return url.Parse(server.URL)
+			},
+		}
+		client = etcd.NewClient(&etcd.Config{
+			EtcdIP:       "1.1.1.1",
+			HTTPClient:   &http.Client{Transport: transport},
+			EtcdProtocol: "http",
+		})
+	})
+
+	Describe("#GetStatus", func() {
+		BeforeEach(func() {
+			handlers["/v3/maintenance/status"] = `{"header":{"cluster_id":"14841639068965178418","member_id":"10276657743932975437","revision":"27","raft_term":"4"},"version":"3.4.3","dbSize":"24576","leader":"10276657743932975437","raftIndex":"31","raftTerm":"4","errors":["memberID:10276657743932975437 alarm:NOSPACE "]}`
+		})
+
+		It("posts to the gateway and parses the string encoded integers", func() {
+			status, err := client.GetStatus(context.Background())
+			Ω(err).Should(BeNil())
+			Ω(methods["/v3/maintenance/status"]).Should(Equal("POST"))
+			Ω(status.Header.MemberID).Should(Equal(uint64(10276657743932975437)))
+			Ω(status.Leader).Should(Equal(uint64(10276657743932975437)))
+			Ω(status.RaftTerm).Should(Equal(uint64(4)))
+			Ω(status.RaftIndex).Should(Equal(uint64(31)))
+			Ω(status.DBSize).Should(Equal(uint64(24576)))
+			Ω(status.Errors).Should(HaveLen(1))
+			Ω(status.IsLeader()).Should(BeTrue())
+		})
+	})
+
+	Describe("#GetMemberList", func() {
+		BeforeEach(func() {
+			handlers["/v3/cluster/member/list"] = `{"header":{"member_id":"10276657743932975437"},"members":[{"ID":"10276657743932975437","name":"etcd-0","peerURLs":["http://1.1.1.1:2380"],"clientURLs":["http://1.1.1.1:2379"]}]}`
+		})
+
+		It("returns the members with IDs formatted as in the v2 API", func() {
+			members, err := client.GetMemberList(context.Background())
+			Ω(err).Should(BeNil())
+			Ω(members).Should(Equal([]etcd.Member{
+				{ID: "8e9e05c52164694d", Name: "etcd-0", PeerURLs: []string{"http://1.1.1.1:2380"}, ClientURLs: []string{"http://1.1.1.1:2379"}},
+			}))
+		})
+	})
+
+	Describe("#DetectAPI", func() {
+		It("picks v3 from etcd 3.4", func() {
+			handlers["/version"] = `{"etcdserver":"3.4.3","etcdcluster":"3.4.0"}`
+			Ω(client.DetectAPI(context.Background())).Should(Equal(etcd.APIv3))
+		})
+
+		It("picks v2 before etcd 3.4", func() {
+			handlers["/version"] = `{"etcdserver":"3.3.11","etcdcluster":"3.3.0"}`
+			Ω(client.DetectAPI(context.Background())).Should(Equal(etcd.APIv2))
+		})
+
+		It("picks v2 from etcd 2", func() {
+			handlers["/version"] = `{"etcdserver":"2.3.7","etcdcluster":"2.3.0"}`
+			Ω(client.DetectAPI(context.Background())).Should(Equal(etcd.APIv2))
+		})
+
+		It("returns an error when the node reports no version", func() {
+			handlers["/version"] = `{}`
+			_, err := client.DetectAPI(context.Background())
+			Ω(err).Should(MatchError("etcd 1.1.1.1 did not report a server version"))
+		})
+	})
+})
+
+var _ = Describe("#GetRaftStatus", func() {
+	var (
+		client  *etcd.Client
+		headers map[string]string
+		method  string
+	)
+
+	BeforeEach(func() {
+		headers = map[string]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(200)
+		}))
+
+		transport := &http.Transport{
+			Proxy: func(req *http.Request) (*url.URL, error) {
+				return url.Parse(server.URL)
+			},
+		}
+		client = etcd.NewClient(&etcd.Config{
+			EtcdIP:       "1.1.1.1",
+			HTTPClient:   &http.Client{Transport: transport},
+			EtcdProtocol: "http",
+		})
+	})
+
+	It("reads the raft term and index headers of the root key", func() {
+		headers["X-Raft-Term"] = "7"
+		headers["X-Raft-Index"] = "123456"
+		status, err := client.GetRaftStatus(context.Background())
+		Ω(err).Should(BeNil())
+		Ω(method).Should(Equal("HEAD"))
+		Ω(status).Should(Equal(etcd.RaftStatus{Term: 7, Index: 123456}))
+	})
+
+	It("returns zeros when the node does not report them", func() {
+		status, err := client.GetRaftStatus(context.Background())
+		Ω(err).Should(BeNil())
+		Ω(status).Should(Equal(etcd.RaftStatus{}))
+	})
+})
@@ -0,0 +1,71 @@
+package health
+
+import "sync"
+
+// Confirmation - how many consecutive checks confirm a change in health, the maintenance under way if any and
+// whether it is BOSH updating the deployment
+type Confirmation struct {
+	UnhealthyChecks int
+	HealthyChecks   int
+	Maintenance     string
+	Updating        bool
+}
+
+// Confirmer - turns the raw verdict of each check into a confirmed one. The confirmed verdict only turns unhealthy
+// once enough consecutive checks failed and only recovers once enough consecutive checks passed, so a cluster
+// flapping between the two keeps its confirmed verdict. The reason for an unhealthy verdict follows the latest check.
+type Confirmer struct {
+	mutex            sync.Mutex
+	confirmedHealthy bool
+	confirmedMessage string
+	unhealthyChecks  int
+	healthyChecks    int
+}
+
+// NewConfirmer - returns a confirmer that considers the cluster healthy until proven otherwise
+func NewConfirmer() *Confirmer {
+	return &Confirmer{confirmedHealthy: true, confirmedMessage: MessageHealthy}
+}
+
+// Confirm - records the report's raw verdict and replaces its verdict with the confirmed one. During maintenance
+// an unhealthy cluster is reported as healthy with the maintenance or deployment in progress verdict, while still
+// counting towards confirmation.
+func (c *Confirmer) Confirm(report Report, confirmation Confirmation) Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	report.RawHealthy = report.Healthy
+	report.RawMessage = report.Message
+	if report.Healthy {
+		c.healthyChecks++
+		c.unhealthyChecks = 0
+		if c.healthyChecks >= confirmation.HealthyChecks {
+			c.confirmedHealthy = true
+		}
+	} else {
+		c.unhealthyChecks++
+		c.healthyChecks = 0
+		if c.unhealthyChecks >= confirmation.UnhealthyChecks {
+			c.confirmedHealthy = false
+		}
+	}
+	if c.confirmedHealthy == report.Healthy {
+		c.confirmedMessage = report.Message
+	}
+	report.Healthy = c.confirmedHealthy
+	report.Message = c.confirmedMessage
+	report.UnhealthyChecks = c.unhealthyChecks
+
+	if confirmation.Maintenance != "" {
+		report.Maintenance = confirmation.Maintenance
+		report.Updating = confirmation.Updating
+		if !report.Healthy || !report.RawHealthy {
+			report.Healthy = true
+			report.Message = MessageMaintenance
+			if confirmation.Updating {
+				report.Message = MessageDeploymentInProgress
+			}
+		}
+	}
+	return report
+}
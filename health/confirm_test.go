@@ -0,0 +1,103 @@
+package health_test
+
+import (
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Confirmer", func() {
+	var (
+		confirmer    *health.Confirmer
+		confirmation health.Confirmation
+	)
+
+	healthy := health.Report{Healthy: true, Message: health.MessageHealthy}
+	unhealthy := func(message string) health.Report {
+		return health.Report{Healthy: false, Message: message}
+	}
+
+	BeforeEach(func() {
+		confirmer = health.NewConfirmer()
+		confirmation = health.Confirmation{UnhealthyChecks: 3, HealthyChecks: 2}
+	})
+
+	It("confirms a problem once it persisted for enough consecutive checks", func() {
+		for i := 1; i <= 2; i++ {
+			report := confirmer.Confirm(unhealthy(health.MessageIncorrectFollowers), confirmation)
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Message).Should(Equal(health.MessageHealthy))
+			Ω(report.RawHealthy).Should(BeFalse())
+			Ω(report.RawMessage).Should(Equal(health.MessageIncorrectFollowers))
+			Ω(report.UnhealthyChecks).Should(Equal(i))
+		}
+		report := confirmer.Confirm(unhealthy(health.MessageTooManyLeaders), confirmation)
+		Ω(report.Healthy).Should(BeFalse())
+		Ω(report.Message).Should(Equal(health.MessageTooManyLeaders))
+		Ω(report.UnhealthyChecks).Should(Equal(3))
+	})
+
+	It("starts counting again after a healthy check", func() {
+		confirmer.Confirm(unhealthy(health.MessageIncorrectFollowers), confirmation)
+		confirmer.Confirm(unhealthy(health.MessageIncorrectFollowers), confirmation)
+		confirmer.Confirm(healthy, confirmation)
+		report := confirmer.Confirm(unhealthy(health.MessageIncorrectFollowers), confirmation)
+		Ω(report.Healthy).Should(BeTrue())
+		Ω(report.UnhealthyChecks).Should(Equal(1))
+	})
+
+	It("dampens a flapping cluster by only confirming recovery after enough healthy checks", func() {
+		for i := 0; i < 3; i++ {
+			confirmer.Confirm(unhealthy(health.MessageNodeUnreachable), confirmation)
+		}
+		report := confirmer.Confirm(healthy, confirmation)
+		Ω(report.Healthy).Should(BeFalse())
+		Ω(report.Message).Should(Equal(health.MessageNodeUnreachable))
+		Ω(report.RawHealthy).Should(BeTrue())
+
+		report = confirmer.Confirm(unhealthy(health.MessageNodeUnreachable), confirmation)
+		Ω(report.Healthy).Should(BeFalse())
+
+		confirmer.Confirm(healthy, confirmation)
+		report = confirmer.Confirm(healthy, confirmation)
+		Ω(report.Healthy).Should(BeTrue())
+		Ω(report.Message).Should(Equal(health.MessageHealthy))
+	})
+
+	It("confirms immediately when a single check is enough", func() {
+		report := confirmer.Confirm(unhealthy(health.MessageQuorumLost), health.Confirmation{UnhealthyChecks: 1, HealthyChecks: 1})
+		Ω(report.Healthy).Should(BeFalse())
+		Ω(report.Message).Should(Equal(health.MessageQuorumLost))
+	})
+
+	Context("during maintenance", func() {
+		BeforeEach(func() {
+			confirmation.Maintenance = "scheduled window 0 2 * * 0 2h"
+		})
+
+		It("reports an unhealthy cluster as under maintenance", func() {
+			for i := 0; i < 3; i++ {
+				report := confirmer.Confirm(unhealthy(health.MessageIncorrectFollowers), confirmation)
+				Ω(report.Healthy).Should(BeTrue())
+				Ω(report.Message).Should(Equal(health.MessageMaintenance))
+				Ω(report.Maintenance).Should(Equal("scheduled window 0 2 * * 0 2h"))
+			}
+		})
+
+		It("reports an unhealthy cluster as deploying while BOSH updates it", func() {
+			confirmation.Maintenance = "BOSH task 42 (create deployment) is processing"
+			confirmation.Updating = true
+			report := confirmer.Confirm(unhealthy(health.MessageIncorrectFollowers), confirmation)
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Message).Should(Equal(health.MessageDeploymentInProgress))
+			Ω(report.Updating).Should(BeTrue())
+		})
+
+		It("keeps the healthy verdict of a healthy cluster", func() {
+			report := confirmer.Confirm(healthy, confirmation)
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Message).Should(Equal(health.MessageHealthy))
+			Ω(report.Maintenance).Should(Equal("scheduled window 0 2 * * 0 2h"))
+		})
+	})
+})
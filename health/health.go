@@ -0,0 +1,395 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// MessageHealthy - returned when the cluster has one leader with the expected followers
+	MessageHealthy = "Everything is healthy"
+	// MessageIncorrectFollowers - returned when a leader does not have a follower for every other node
+	MessageIncorrectFollowers = "Incorrect number of followers"
+	// MessageTooManyLeaders - returned when more than one node claims leadership
+	MessageTooManyLeaders = "Too many leaders"
+	// MessageNotEnoughLeaders - returned when no node claims leadership
+	MessageNotEnoughLeaders = "Not enough leaders"
+	// MessageNodeUnreachable - returned when a minority of nodes could not be probed
+	MessageNodeUnreachable = "Node unreachable"
+	// MessageQuorumLost - returned when fewer than a majority of nodes could be probed
+	MessageQuorumLost = "Quorum lost"
+	// MessageStale - added when the cached report is older than allowed
+	MessageStale = "Cluster state is stale"
+	// MessageFollowerDegraded - returned when a follower is lagging or failing to receive messages from the leader
+	MessageFollowerDegraded = "Follower degraded"
+	// MessageSplitBrain - returned when nodes disagree about which member is the leader
+	MessageSplitBrain = "Split brain"
+	// MessageLeaderMismatch - returned when the node claiming leadership is not the leader the other nodes agree on
+	MessageLeaderMismatch = "Leader mismatch"
+	// MessageMembershipMismatch - returned when a node's view of the cluster members differs from the other nodes
+	MessageMembershipMismatch = "Membership mismatch"
+	// MessageUnknownMember - returned when a VM answers as an etcd member that is not in the cluster member list
+	MessageUnknownMember = "Unknown member"
+	// MessageStaleMember - returned when the cluster member list contains a member that matches no VM
+	MessageStaleMember = "Stale member"
+	// MessageNodeErrors - returned when a node reports errors in its v3 status, such as raised alarms
+	MessageNodeErrors = "Node reporting errors"
+	// MessageTermDivergence - returned when a node's raft term differs from the term most nodes are in
+	MessageTermDivergence = "Raft term divergence"
+	// MessageIndexLag - returned when a node's raft index lags the leader's by more than the threshold
+	MessageIndexLag = "Raft index lagging"
+	// MessageLeaderFlapping - returned when more elections than allowed were observed within the flapping window
+	MessageLeaderFlapping = "Leader flapping"
+	// MessageMaintenance - returned instead of an unhealthy verdict during a maintenance window
+	MessageMaintenance = "Maintenance in progress"
+	// MessageDeploymentInProgress - returned instead of an unhealthy verdict while BOSH is updating the deployment
+	MessageDeploymentInProgress = "Deployment in progress"
+	// MessageCheckFailed - returned for a cluster that could not be checked at all, such as when discovery failed
+	MessageCheckFailed = "Check failed"
+)
+
+// Node - the observed state of a single etcd VM or endpoint
+type Node struct {
+	IP            string     `json:"ip"`
+	Endpoint      string     `json:"endpoint,omitempty"`
+	JobName       string     `json:"job_name"`
+	Index         int        `json:"index"`
+	VMCID         string     `json:"vm_cid"`
+	ID            string     `json:"id,omitempty"`
+	Name          string     `json:"name,omitempty"`
+	State         string     `json:"state,omitempty"`
+	LeaderID      string     `json:"leader_id,omitempty"`
+	API           string     `json:"api,omitempty"`
+	RaftTerm      uint64     `json:"raft_term,omitempty"`
+	RaftIndex     uint64     `json:"raft_index,omitempty"`
+	RaftApplied   uint64     `json:"raft_applied_index,omitempty"`
+	DBSizeBytes   uint64     `json:"db_size_bytes,omitempty"`
+	Errors        []string   `json:"errors,omitempty"`
+	Reachable     bool       `json:"reachable"`
+	Leader        bool       `json:"leader"`
+	Followers     int        `json:"followers"`
+	LatencyMS     float64    `json:"latency_ms"`
+	Error         string     `json:"error,omitempty"`
+	ErrorReason   string     `json:"error_reason,omitempty"`
+	FollowerStats []Follower `json:"follower_stats,omitempty"`
+	Members       []Member   `json:"members,omitempty"`
+}
+
+// Follower - the leader's view of one of its followers
+type Follower struct {
+	ID                  string  `json:"id"`
+	LatencyCurrentMS    float64 `json:"latency_current_ms"`
+	LatencyAverageMS    float64 `json:"latency_average_ms"`
+	LatencyStdDevMS     float64 `json:"latency_stddev_ms"`
+	LatencyMinimumMS    float64 `json:"latency_minimum_ms"`
+	LatencyMaximumMS    float64 `json:"latency_maximum_ms"`
+	SuccessCount        uint64  `json:"success_count"`
+	FailCount           uint64  `json:"fail_count"`
+	FailCountSinceCheck uint64  `json:"fail_count_since_last_check"`
+	Degraded            bool    `json:"degraded"`
+}
+
+// LeaderGroup - the nodes that agree on the same leader, an empty leader ID means no leader is known
+type LeaderGroup struct {
+	LeaderID string   `json:"leader_id"`
+	Members  []string `json:"members"`
+}
+
+// Thresholds - limits beyond which a follower is considered degraded or lagging, zero disables a check
+type Thresholds struct {
+	FollowerLatency  time.Duration
+	FollowerFailures uint64
+	RaftIndexLag     uint64
+}
+
+// Problem - a single issue detected in the cluster, optionally tied to a node
+type Problem struct {
+	Message string `json:"message"`
+	IP      string `json:"ip,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Report - the overall verdict for a cluster along with every node and problem found
+type Report struct {
+	Cluster         string        `json:"cluster,omitempty"`
+	DirectorName    string        `json:"director,omitempty"`
+	Director        string        `json:"director_uuid,omitempty"`
+	Deployment      string        `json:"deployment,omitempty"`
+	Job             string        `json:"job,omitempty"`
+	Healthy         bool          `json:"healthy"`
+	Message         string        `json:"message"`
+	RawHealthy      bool          `json:"raw_healthy"`
+	RawMessage      string        `json:"raw_message"`
+	UnhealthyChecks int           `json:"unhealthy_checks"`
+	Maintenance     string        `json:"maintenance,omitempty"`
+	Updating        bool          `json:"updating"`
+	Problems        []Problem     `json:"problems"`
+	Nodes           []Node        `json:"nodes"`
+	LeaderGroups    []LeaderGroup `json:"leader_groups"`
+	Members         []Member      `json:"members"`
+	CheckedAt       time.Time     `json:"checked_at"`
+	DiscoveredAt    time.Time     `json:"discovered_at"`
+	AgeSeconds      float64       `json:"age_seconds"`
+	Stale           bool          `json:"stale"`
+	LastError       string        `json:"last_error,omitempty"`
+}
+
+// Evaluate - builds a report from the observed nodes, recording every problem found
+func Evaluate(nodes []Node, thresholds Thresholds) Report {
+	var (
+		leaders   []string
+		reachable int
+	)
+
+	report := Report{
+		Problems: []Problem{},
+		Nodes:    nodes,
+	}
+	if report.Nodes == nil {
+		report.Nodes = []Node{}
+	}
+
+	for _, node := range nodes {
+		if !node.Reachable {
+			report.Problems = append(report.Problems, Problem{
+				Message: MessageNodeUnreachable,
+				IP:      node.IP,
+				Detail:  unreachableDetail(node),
+			})
+			continue
+		}
+		reachable++
+		if len(node.Errors) > 0 {
+			report.Problems = append(report.Problems, Problem{
+				Message: MessageNodeErrors,
+				IP:      node.IP,
+				Detail:  strings.Join(node.Errors, ", "),
+			})
+		}
+		if !node.Leader {
+			continue
+		}
+		leaders = append(leaders, node.IP)
+		if node.Followers != len(nodes)-1 {
+			report.Problems = append(report.Problems, Problem{
+				Message: MessageIncorrectFollowers,
+				IP:      node.IP,
+				Detail:  fmt.Sprintf("leader has %d followers, expected %d", node.Followers, len(nodes)-1),
+			})
+		}
+		for i := range node.FollowerStats {
+			follower := &node.FollowerStats[i]
+			for _, detail := range degradation(*follower, thresholds) {
+				follower.Degraded = true
+				report.Problems = append(report.Problems, Problem{
+					Message: MessageFollowerDegraded,
+					IP:      node.IP,
+					Detail:  fmt.Sprintf("follower %s %s", follower.ID, detail),
+				})
+			}
+		}
+	}
+
+	if len(nodes) > 0 && reachable < Quorum(len(nodes)) {
+		report.Problems = append(report.Problems, Problem{
+			Message: MessageQuorumLost,
+			Detail:  fmt.Sprintf("%d of %d nodes answered, %d required", reachable, len(nodes), Quorum(len(nodes))),
+		})
+	}
+
+	report.LeaderGroups = leaderGroups(nodes)
+	if len(report.LeaderGroups) > 1 {
+		var groups []string
+		for _, group := range report.LeaderGroups {
+			groups = append(groups, fmt.Sprintf("%s: %v", describeLeader(group.LeaderID), group.Members))
+		}
+		report.Problems = append(report.Problems, Problem{
+			Message: MessageSplitBrain,
+			Detail:  fmt.Sprintf("nodes disagree on the leader: %s", strings.Join(groups, ", ")),
+		})
+	} else if len(report.LeaderGroups) == 1 {
+		agreed := report.LeaderGroups[0].LeaderID
+		for _, node := range nodes {
+			if node.Reachable && node.Leader && node.ID != "" && node.ID != agreed {
+				report.Problems = append(report.Problems, Problem{
+					Message: MessageLeaderMismatch,
+					IP:      node.IP,
+					Detail:  fmt.Sprintf("node %s claims leadership but members agree on %s", node.ID, describeLeader(agreed)),
+				})
+			}
+		}
+	}
+	if len(report.LeaderGroups) > 0 {
+		for _, node := range nodes {
+			if node.Reachable && node.ID != "" && node.LeaderID == "" {
+				report.Problems = append(report.Problems, Problem{
+					Message: MessageFollowerDegraded,
+					IP:      node.IP,
+					Detail:  fmt.Sprintf("node %s knows of no leader while other members follow one", node.ID),
+				})
+			}
+		}
+	}
+
+	members, problems := membership(nodes)
+	report.Members = members
+	report.Problems = append(report.Problems, problems...)
+	report.Problems = append(report.Problems, raftProgress(nodes, thresholds)...)
+
+	if len(leaders) > 1 {
+		report.Problems = append(report.Problems, Problem{
+			Message: MessageTooManyLeaders,
+			Detail:  fmt.Sprintf("%d nodes claim leadership: %v", len(leaders), leaders),
+		})
+	} else if len(leaders) == 0 {
+		report.Problems = append(report.Problems, Problem{
+			Message: MessageNotEnoughLeaders,
+			Detail:  "no node claims leadership",
+		})
+	}
+
+	report.Healthy = len(report.Problems) == 0
+	report.Message = verdict(report.Problems)
+	return report
+}
+
+// WithProblem - adds a problem found outside Evaluate, such as from the leader history, and recomputes the verdict
+func WithProblem(report Report, problem Problem) Report {
+	report.Problems = append(append([]Problem{}, report.Problems...), problem)
+	report.Healthy = false
+	report.Message = verdict(report.Problems)
+	return report
+}
+
+// leaderGroups - groups the reachable nodes that reported their identity by the leader they believe in. Nodes that
+// know of no leader, such as during an election or while catching up, are left out rather than seen as disagreeing.
+func leaderGroups(nodes []Node) []LeaderGroup {
+	groups := []LeaderGroup{}
+	index := make(map[string]int)
+	for _, node := range nodes {
+		if !node.Reachable || node.ID == "" || node.LeaderID == "" {
+			continue
+		}
+		i, ok := index[node.LeaderID]
+		if !ok {
+			i = len(groups)
+			index[node.LeaderID] = i
+			groups = append(groups, LeaderGroup{LeaderID: node.LeaderID})
+		}
+		groups[i].Members = append(groups[i].Members, node.IP)
+	}
+	return groups
+}
+
+func describeLeader(leaderID string) string {
+	if leaderID == "" {
+		return "no leader"
+	}
+	return leaderID
+}
+
+// raftProgress - flags nodes whose raft term differs from most nodes, or whose index lags the leader's,
+// nodes that did not report a term or index are ignored
+func raftProgress(nodes []Node, thresholds Thresholds) []Problem {
+	var (
+		problems    []Problem
+		leaderIndex uint64
+		majority    uint64
+	)
+
+	terms := make(map[uint64]int)
+	for _, node := range nodes {
+		if !node.Reachable {
+			continue
+		}
+		if node.RaftTerm > 0 {
+			terms[node.RaftTerm]++
+		}
+		if node.Leader && node.RaftIndex > leaderIndex {
+			leaderIndex = node.RaftIndex
+		}
+	}
+	for term, count := range terms {
+		if count > terms[majority] || (count == terms[majority] && term > majority) {
+			majority = term
+		}
+	}
+
+	for _, node := range nodes {
+		if !node.Reachable {
+			continue
+		}
+		if node.RaftTerm > 0 && node.RaftTerm != majority {
+			problems = append(problems, Problem{
+				Message: MessageTermDivergence,
+				IP:      node.IP,
+				Detail:  fmt.Sprintf("node is in term %d, most nodes are in term %d", node.RaftTerm, majority),
+			})
+		}
+		if thresholds.RaftIndexLag > 0 && node.RaftIndex > 0 && leaderIndex > node.RaftIndex+thresholds.RaftIndexLag {
+			problems = append(problems, Problem{
+				Message: MessageIndexLag,
+				IP:      node.IP,
+				Detail:  fmt.Sprintf("raft index %d is %d behind the leader's %d, more than %d", node.RaftIndex, leaderIndex-node.RaftIndex, leaderIndex, thresholds.RaftIndexLag),
+			})
+		}
+	}
+	return problems
+}
+
+// degradation - describes each way a follower exceeds the thresholds
+func degradation(follower Follower, thresholds Thresholds) []string {
+	var details []string
+
+	limitMS := thresholds.FollowerLatency.Seconds() * 1000
+	if limitMS > 0 && follower.LatencyCurrentMS > limitMS {
+		details = append(details, fmt.Sprintf("latency %.3fms exceeds %.3fms", follower.LatencyCurrentMS, limitMS))
+	}
+	if thresholds.FollowerFailures > 0 && follower.FailCountSinceCheck > thresholds.FollowerFailures {
+		details = append(details, fmt.Sprintf("failed %d times since the last check, more than %d", follower.FailCountSinceCheck, thresholds.FollowerFailures))
+	}
+	return details
+}
+
+// unreachableDetail - describes why a node could not be probed
+func unreachableDetail(node Node) string {
+	if node.ErrorReason == "" {
+		return node.Error
+	}
+	return fmt.Sprintf("%s: %s", node.ErrorReason, node.Error)
+}
+
+// Quorum - returns the number of members required for a cluster of the given size to make progress
+func Quorum(members int) int {
+	return members/2 + 1
+}
+
+// verdict - picks the overall message, most severe problem first
+func verdict(problems []Problem) string {
+	precedence := []string{
+		MessageQuorumLost,
+		MessageSplitBrain,
+		MessageTooManyLeaders,
+		MessageNotEnoughLeaders,
+		MessageLeaderFlapping,
+		MessageLeaderMismatch,
+		MessageTermDivergence,
+		MessageMembershipMismatch,
+		MessageUnknownMember,
+		MessageStaleMember,
+		MessageNodeErrors,
+		MessageIncorrectFollowers,
+		MessageNodeUnreachable,
+		MessageIndexLag,
+		MessageFollowerDegraded,
+	}
+	for _, message := range precedence {
+		for _, problem := range problems {
+			if problem.Message == message {
+				return message
+			}
+		}
+	}
+	return MessageHealthy
+}
@@ -0,0 +1,445 @@
+package health_test
+
+import (
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("#Evaluate", func() {
+	var (
+		nodes      []health.Node
+		thresholds health.Thresholds
+		report     health.Report
+	)
+
+	JustBeforeEach(func() {
+		report = health.Evaluate(nodes, thresholds)
+	})
+
+	Context("when there is one leader with the correct number of followers", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2},
+				{IP: "2.2.2.2", Reachable: true},
+				{IP: "3.3.3.3", Reachable: true},
+			}
+		})
+
+		It("returns a healthy report", func() {
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Message).Should(Equal(health.MessageHealthy))
+			Ω(report.Problems).Should(BeEmpty())
+			Ω(report.Nodes).Should(Equal(nodes))
+		})
+	})
+
+	Context("when the leader has too few followers", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 1},
+				{IP: "2.2.2.2", Reachable: true},
+				{IP: "3.3.3.3", Reachable: true},
+			}
+		})
+
+		It("reports the leader with incorrect followers", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageIncorrectFollowers))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageIncorrectFollowers,
+				IP:      "1.1.1.1",
+				Detail:  "leader has 1 followers, expected 2",
+			}))
+		})
+	})
+
+	Context("when more than one node claims leadership", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2},
+				{IP: "2.2.2.2", Reachable: true, Leader: true, Followers: 0},
+				{IP: "3.3.3.3", Reachable: true},
+			}
+		})
+
+		It("reports too many leaders and keeps every other problem", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageTooManyLeaders))
+			Ω(report.Problems).Should(HaveLen(2))
+			Ω(report.Problems[0].Message).Should(Equal(health.MessageIncorrectFollowers))
+			Ω(report.Problems[0].IP).Should(Equal("2.2.2.2"))
+			Ω(report.Problems[1].Message).Should(Equal(health.MessageTooManyLeaders))
+		})
+	})
+
+	Context("when no node claims leadership", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true},
+				{IP: "2.2.2.2", Reachable: true},
+			}
+		})
+
+		It("reports not enough leaders", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageNotEnoughLeaders))
+		})
+	})
+
+	Context("when a minority of nodes cannot be probed", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2},
+				{IP: "2.2.2.2", Reachable: true},
+				{IP: "3.3.3.3", Error: "connection refused"},
+			}
+		})
+
+		It("reports the unreachable node", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageNodeUnreachable))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageNodeUnreachable,
+				IP:      "3.3.3.3",
+				Detail:  "connection refused",
+			}))
+		})
+	})
+
+	Context("when a majority of nodes cannot be probed", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2},
+				{IP: "2.2.2.2", Error: "connection refused"},
+				{IP: "3.3.3.3", Error: "connection refused"},
+			}
+		})
+
+		It("reports quorum lost alongside each unreachable node", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageQuorumLost))
+			Ω(report.Problems).Should(HaveLen(3))
+			Ω(report.Problems[2]).Should(Equal(health.Problem{
+				Message: health.MessageQuorumLost,
+				Detail:  "1 of 3 nodes answered, 2 required",
+			}))
+		})
+	})
+
+	Context("when a follower exceeds the thresholds", func() {
+		BeforeEach(func() {
+			thresholds = health.Thresholds{FollowerLatency: 100 * time.Millisecond, FollowerFailures: 5}
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2, FollowerStats: []health.Follower{
+					{ID: "a", LatencyCurrentMS: 250, FailCountSinceCheck: 6},
+					{ID: "b", LatencyCurrentMS: 1, FailCount: 100, FailCountSinceCheck: 5},
+				}},
+				{IP: "2.2.2.2", Reachable: true},
+				{IP: "3.3.3.3", Reachable: true},
+			}
+		})
+
+		AfterEach(func() {
+			thresholds = health.Thresholds{}
+		})
+
+		It("flags the follower as degraded with a problem for each threshold exceeded", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageFollowerDegraded))
+			Ω(report.Nodes[0].FollowerStats[0].Degraded).Should(BeTrue())
+			Ω(report.Nodes[0].FollowerStats[1].Degraded).Should(BeFalse())
+			Ω(report.Problems).Should(Equal([]health.Problem{
+				{Message: health.MessageFollowerDegraded, IP: "1.1.1.1", Detail: "follower a latency 250.000ms exceeds 100.000ms"},
+				{Message: health.MessageFollowerDegraded, IP: "1.1.1.1", Detail: "follower a failed 6 times since the last check, more than 5"},
+			}))
+		})
+	})
+
+	Context("when nodes disagree on the leader", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 2},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true},
+				{IP: "3.3.3.3", ID: "c", LeaderID: "c", Reachable: true},
+			}
+		})
+
+		It("reports split brain listing the groups", func() {
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal(health.MessageSplitBrain))
+			Ω(report.LeaderGroups).Should(Equal([]health.LeaderGroup{
+				{LeaderID: "a", Members: []string{"1.1.1.1", "2.2.2.2"}},
+				{LeaderID: "c", Members: []string{"3.3.3.3"}},
+			}))
+			Ω(report.Problems).Should(ContainElement(health.Problem{
+				Message: health.MessageSplitBrain,
+				Detail:  "nodes disagree on the leader: a: [1.1.1.1 2.2.2.2], c: [3.3.3.3]",
+			}))
+		})
+	})
+
+	Context("when a node knows of no leader while the others agree on one", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 2},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true},
+				{IP: "3.3.3.3", ID: "c", Reachable: true},
+			}
+		})
+
+		It("reports the node as degraded rather than split brain", func() {
+			Ω(report.Message).Should(Equal(health.MessageFollowerDegraded))
+			Ω(report.LeaderGroups).Should(Equal([]health.LeaderGroup{{LeaderID: "a", Members: []string{"1.1.1.1", "2.2.2.2"}}}))
+			Ω(report.Problems).Should(Equal([]health.Problem{{
+				Message: health.MessageFollowerDegraded,
+				IP:      "3.3.3.3",
+				Detail:  "node c knows of no leader while other members follow one",
+			}}))
+		})
+	})
+
+	Context("when every node agrees on a leader other than the one claiming leadership", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "b", Reachable: true, Leader: true, Followers: 1},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "b", Reachable: true},
+			}
+		})
+
+		It("reports a leader mismatch", func() {
+			Ω(report.Message).Should(Equal(health.MessageLeaderMismatch))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageLeaderMismatch,
+				IP:      "1.1.1.1",
+				Detail:  "node a claims leadership but members agree on b",
+			}))
+		})
+	})
+
+	Context("when every node agrees on the node claiming leadership", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 1},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true},
+			}
+		})
+
+		It("returns a healthy report with a single group", func() {
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.LeaderGroups).Should(HaveLen(1))
+		})
+	})
+
+	Context("when every node agrees on membership matching the VMs", func() {
+		BeforeEach(func() {
+			members := []health.Member{
+				{ID: "b", Name: "etcd-1", PeerURLs: []string{"http://2.2.2.2:7001"}, ClientURLs: []string{"http://2.2.2.2:4001"}},
+				{ID: "a", Name: "etcd-0", PeerURLs: []string{"http://1.1.1.1:7001"}, ClientURLs: []string{"http://1.1.1.1:4001"}},
+			}
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 1, Members: members},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true, Members: []health.Member{members[1], members[0]}},
+			}
+		})
+
+		It("returns a healthy report with the members ordered by ID", func() {
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Members).Should(HaveLen(2))
+			Ω(report.Members[0].ID).Should(Equal("a"))
+			Ω(report.Members[1].ID).Should(Equal("b"))
+		})
+	})
+
+	Context("when a node's view of membership differs from the others", func() {
+		BeforeEach(func() {
+			a := health.Member{ID: "a", PeerURLs: []string{"http://1.1.1.1:7001"}}
+			b := health.Member{ID: "b", PeerURLs: []string{"http://2.2.2.2:7001"}}
+			c := health.Member{ID: "c", PeerURLs: []string{"http://3.3.3.3:7001"}}
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 2, Members: []health.Member{a, b, c}},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true, Members: []health.Member{a, b, c}},
+				{IP: "3.3.3.3", ID: "c", LeaderID: "a", Reachable: true, Members: []health.Member{a, c}},
+			}
+		})
+
+		It("reports the node whose view differs", func() {
+			Ω(report.Message).Should(Equal(health.MessageMembershipMismatch))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageMembershipMismatch,
+				IP:      "3.3.3.3",
+				Detail:  "node sees members [a c], other nodes see [a b c]",
+			}))
+			Ω(report.Members).Should(HaveLen(3))
+		})
+	})
+
+	Context("when a VM was recreated with a new IP but its old member entry remains", func() {
+		BeforeEach(func() {
+			members := []health.Member{
+				{ID: "a", PeerURLs: []string{"http://1.1.1.1:7001"}},
+				{ID: "b", PeerURLs: []string{"http://2.2.2.2:7001"}},
+				{ID: "c", Name: "etcd-2", PeerURLs: []string{"http://3.3.3.3:7001"}},
+			}
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 2, Members: members},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true, Members: members},
+				{IP: "4.4.4.4", ID: "d", LeaderID: "a", Reachable: true, Members: members},
+			}
+		})
+
+		It("reports the unknown member and the stale member", func() {
+			Ω(report.Message).Should(Equal(health.MessageUnknownMember))
+			Ω(report.Problems).Should(ConsistOf(
+				health.Problem{
+					Message: health.MessageUnknownMember,
+					IP:      "4.4.4.4",
+					Detail:  "node d is not in the cluster member list",
+				},
+				health.Problem{
+					Message: health.MessageStaleMember,
+					Detail:  "member c (etcd-2) with peer URLs [http://3.3.3.3:7001] matches no VM",
+				},
+			))
+		})
+	})
+
+	Context("when members are advertised by hostname and a VM cannot be probed", func() {
+		BeforeEach(func() {
+			members := []health.Member{
+				{ID: "a", PeerURLs: []string{"https://etcd-0.etcd.service.cf.internal:7001"}},
+				{ID: "b", PeerURLs: []string{"https://etcd-1.etcd.service.cf.internal:7001"}},
+				{ID: "c", PeerURLs: []string{"https://etcd-2.etcd.service.cf.internal:7001"}},
+			}
+			nodes = []health.Node{
+				{IP: "1.1.1.1", ID: "a", LeaderID: "a", Reachable: true, Leader: true, Followers: 2, Members: members},
+				{IP: "2.2.2.2", ID: "b", LeaderID: "a", Reachable: true, Members: members},
+				{IP: "3.3.3.3", Reachable: false, Error: "timeout"},
+			}
+		})
+
+		It("does not report the unprobed member as stale", func() {
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageNodeUnreachable,
+				IP:      "3.3.3.3",
+				Detail:  "timeout",
+			}))
+		})
+	})
+
+	Context("when a node reports errors", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 1, Errors: []string{"alarm:NOSPACE"}},
+				{IP: "2.2.2.2", Reachable: true},
+			}
+		})
+
+		It("reports the errors against the node", func() {
+			Ω(report.Message).Should(Equal(health.MessageNodeErrors))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageNodeErrors,
+				IP:      "1.1.1.1",
+				Detail:  "alarm:NOSPACE",
+			}))
+		})
+	})
+
+	Context("when a node's raft term differs from the majority", func() {
+		BeforeEach(func() {
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2, RaftTerm: 5, RaftIndex: 100},
+				{IP: "2.2.2.2", Reachable: true, RaftTerm: 5, RaftIndex: 100},
+				{IP: "3.3.3.3", Reachable: true, RaftTerm: 9, RaftIndex: 100},
+			}
+		})
+
+		It("reports the diverging node", func() {
+			Ω(report.Message).Should(Equal(health.MessageTermDivergence))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageTermDivergence,
+				IP:      "3.3.3.3",
+				Detail:  "node is in term 9, most nodes are in term 5",
+			}))
+		})
+	})
+
+	Context("when a node's raft index lags the leader", func() {
+		BeforeEach(func() {
+			thresholds.RaftIndexLag = 1000
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 2, RaftTerm: 5, RaftIndex: 5000},
+				{IP: "2.2.2.2", Reachable: true, RaftTerm: 5, RaftIndex: 4500},
+				{IP: "3.3.3.3", Reachable: true, RaftTerm: 5, RaftIndex: 3000},
+			}
+		})
+
+		AfterEach(func() {
+			thresholds.RaftIndexLag = 0
+		})
+
+		It("reports only the node beyond the threshold", func() {
+			Ω(report.Message).Should(Equal(health.MessageIndexLag))
+			Ω(report.Problems).Should(ConsistOf(health.Problem{
+				Message: health.MessageIndexLag,
+				IP:      "3.3.3.3",
+				Detail:  "raft index 3000 is 2000 behind the leader's 5000, more than 1000",
+			}))
+		})
+	})
+
+	Context("when nodes do not report raft progress", func() {
+		BeforeEach(func() {
+			thresholds.RaftIndexLag = 1000
+			nodes = []health.Node{
+				{IP: "1.1.1.1", Reachable: true, Leader: true, Followers: 1, RaftTerm: 5, RaftIndex: 5000},
+				{IP: "2.2.2.2", Reachable: true},
+			}
+		})
+
+		AfterEach(func() {
+			thresholds.RaftIndexLag = 0
+		})
+
+		It("does not flag them", func() {
+			Ω(report.Healthy).Should(BeTrue())
+		})
+	})
+
+	Context("when there are no nodes", func() {
+		BeforeEach(func() {
+			nodes = nil
+		})
+
+		It("returns an empty node list rather than null", func() {
+			Ω(report.Nodes).ShouldNot(BeNil())
+			Ω(report.Message).Should(Equal(health.MessageNotEnoughLeaders))
+		})
+	})
+})
+
+var _ = Describe("#WithProblem", func() {
+	It("adds the problem and recomputes the verdict", func() {
+		report := health.Evaluate([]health.Node{
+			{IP: "1.1.1.1", Reachable: true, Leader: true},
+		}, health.Thresholds{})
+		flapping := health.Problem{Message: health.MessageLeaderFlapping, Detail: "4 elections in the last 10m0s, more than 3"}
+
+		updated := health.WithProblem(report, flapping)
+		Ω(updated.Healthy).Should(BeFalse())
+		Ω(updated.Message).Should(Equal(health.MessageLeaderFlapping))
+		Ω(updated.Problems).Should(ConsistOf(flapping))
+		Ω(report.Problems).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("#Quorum", func() {
+	It("returns a strict majority of members", func() {
+		Ω(health.Quorum(1)).Should(Equal(1))
+		Ω(health.Quorum(2)).Should(Equal(2))
+		Ω(health.Quorum(3)).Should(Equal(2))
+		Ω(health.Quorum(5)).Should(Equal(3))
+	})
+})
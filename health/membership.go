@@ -0,0 +1,167 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Member - an etcd cluster member as listed by /v2/members
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peer_urls"`
+	ClientURLs []string `json:"client_urls"`
+}
+
+type membersByID []Member
+
+func (m membersByID) Len() int           { return len(m) }
+func (m membersByID) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m membersByID) Less(i, j int) bool { return m[i].ID < m[j].ID }
+
+// membership - compares the member list reported by each node with the other nodes and with the VMs,
+// returning the member list most nodes agree on
+func membership(nodes []Node) ([]Member, []Problem) {
+	var (
+		problems []Problem
+		order    []string
+	)
+
+	views := make(map[string][]Member)
+	counts := make(map[string]int)
+	keys := make([]string, len(nodes))
+	for i, node := range nodes {
+		if !node.Reachable || node.Members == nil {
+			continue
+		}
+		keys[i] = membershipKey(node.Members)
+		if _, ok := counts[keys[i]]; !ok {
+			order = append(order, keys[i])
+			views[keys[i]] = sortedMembers(node.Members)
+		}
+		counts[keys[i]]++
+	}
+	if len(order) == 0 {
+		return []Member{}, nil
+	}
+
+	agreed := order[0]
+	for _, key := range order[1:] {
+		if counts[key] > counts[agreed] {
+			agreed = key
+		}
+	}
+	members := views[agreed]
+	for i, node := range nodes {
+		if keys[i] != "" && keys[i] != agreed {
+			problems = append(problems, Problem{
+				Message: MessageMembershipMismatch,
+				IP:      node.IP,
+				Detail:  fmt.Sprintf("node sees members %s, other nodes see %s", describeMembers(views[keys[i]]), describeMembers(members)),
+			})
+		}
+	}
+
+	memberIDs := make(map[string]bool)
+	for _, member := range members {
+		memberIDs[member.ID] = true
+	}
+	nodeIDs := make(map[string]bool)
+	vmIPs := make(map[string]bool)
+	allIdentified := true
+	for _, node := range nodes {
+		vmIPs[node.IP] = true
+		if !node.Reachable || node.ID == "" {
+			allIdentified = false
+			continue
+		}
+		nodeIDs[node.ID] = true
+		if !memberIDs[node.ID] {
+			problems = append(problems, Problem{
+				Message: MessageUnknownMember,
+				IP:      node.IP,
+				Detail:  fmt.Sprintf("node %s is not in the cluster member list", node.ID),
+			})
+		}
+	}
+
+	for _, member := range members {
+		hosts := memberHosts(member)
+		if nodeIDs[member.ID] || anyHostIn(hosts, vmIPs) {
+			continue
+		}
+		// members advertised by hostname can only be matched by ID, which needs every VM to have answered
+		if allIdentified || allIPs(hosts) {
+			problems = append(problems, Problem{
+				Message: MessageStaleMember,
+				Detail:  fmt.Sprintf("member %s (%s) with peer URLs %v matches no VM", member.ID, member.Name, member.PeerURLs),
+			})
+		}
+	}
+	return members, problems
+}
+
+// membershipKey - a canonical form of a member list so lists can be compared regardless of order
+func membershipKey(members []Member) string {
+	var entries []string
+	for _, member := range sortedMembers(members) {
+		peers := append([]string{}, member.PeerURLs...)
+		clients := append([]string{}, member.ClientURLs...)
+		sort.Strings(peers)
+		sort.Strings(clients)
+		entries = append(entries, fmt.Sprintf("%s|%s|%s", member.ID, strings.Join(peers, ","), strings.Join(clients, ",")))
+	}
+	return "[" + strings.Join(entries, ";") + "]"
+}
+
+func sortedMembers(members []Member) []Member {
+	sorted := append([]Member{}, members...)
+	sort.Sort(membersByID(sorted))
+	return sorted
+}
+
+func describeMembers(members []Member) string {
+	var ids []string
+	for _, member := range members {
+		ids = append(ids, member.ID)
+	}
+	return fmt.Sprintf("%v", ids)
+}
+
+// memberHosts - the hosts of every peer and client URL a member advertises
+func memberHosts(member Member) []string {
+	var hosts []string
+	for _, raw := range append(append([]string{}, member.PeerURLs...), member.ClientURLs...) {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		host, _, err := net.SplitHostPort(parsed.Host)
+		if err != nil {
+			host = parsed.Host
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func anyHostIn(hosts []string, set map[string]bool) bool {
+	for _, host := range hosts {
+		if set[host] {
+			return true
+		}
+	}
+	return false
+}
+
+func allIPs(hosts []string) bool {
+	for _, host := range hosts {
+		if net.ParseIP(host) == nil {
+			return false
+		}
+	}
+	return len(hosts) > 0
+}
@@ -0,0 +1,165 @@
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// Period - a span of time during which the same member was leader, an empty leader ID means no agreed leader
+type Period struct {
+	LeaderID string     `json:"leader_id"`
+	LeaderIP string     `json:"leader_ip,omitempty"`
+	Term     uint64     `json:"term,omitempty"`
+	From     time.Time  `json:"from"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// Change - a single leader change observed between two checks
+type Change struct {
+	At           time.Time `json:"at"`
+	Cluster      string    `json:"cluster,omitempty"`
+	FromLeaderID string    `json:"from_leader_id"`
+	FromIP       string    `json:"from_ip,omitempty"`
+	ToLeaderID   string    `json:"to_leader_id"`
+	ToIP         string    `json:"to_ip,omitempty"`
+	Term         uint64    `json:"term,omitempty"`
+}
+
+// IsElection - returns true when the change brought in a leader, rather than losing one
+func (c Change) IsElection() bool {
+	return c.ToLeaderID != ""
+}
+
+// Observation - the leader seen by a single check
+type Observation struct {
+	At       time.Time
+	LeaderID string
+	LeaderIP string
+	Term     uint64
+}
+
+// Timeline - the leadership history recorded by the polling loop, keeping at most limit changes
+type Timeline struct {
+	mutex   sync.Mutex
+	limit   int
+	periods []Period
+	changes []Change
+}
+
+// NewTimeline - returns an empty timeline keeping at most limit periods and changes
+func NewTimeline(limit int) *Timeline {
+	return &Timeline{limit: limit}
+}
+
+// Record - adds an observation, returning the change when the leader or its term differs from the last observation
+func (t *Timeline) Record(observation Observation) (Change, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.periods) == 0 {
+		t.periods = append(t.periods, Period{
+			LeaderID: observation.LeaderID,
+			LeaderIP: observation.LeaderIP,
+			Term:     observation.Term,
+			From:     observation.At,
+		})
+		return Change{}, false
+	}
+
+	current := &t.periods[len(t.periods)-1]
+	newTerm := observation.Term > 0 && current.Term > 0 && observation.Term > current.Term
+	if observation.LeaderID == current.LeaderID && !newTerm {
+		if observation.Term > current.Term {
+			current.Term = observation.Term
+		}
+		if observation.LeaderIP != "" {
+			current.LeaderIP = observation.LeaderIP
+		}
+		return Change{}, false
+	}
+
+	change := Change{
+		At:           observation.At,
+		FromLeaderID: current.LeaderID,
+		FromIP:       current.LeaderIP,
+		ToLeaderID:   observation.LeaderID,
+		ToIP:         observation.LeaderIP,
+		Term:         observation.Term,
+	}
+	until := observation.At
+	current.Until = &until
+	t.periods = append(t.periods, Period{
+		LeaderID: observation.LeaderID,
+		LeaderIP: observation.LeaderIP,
+		Term:     observation.Term,
+		From:     observation.At,
+	})
+	t.changes = append(t.changes, change)
+	t.trim()
+	return change, true
+}
+
+// Load - rebuilds the timeline from stored changes, oldest first, such as after a restart; the period before
+// the first change is unknown so the timeline starts with the leader the first change brought in
+func (t *Timeline) Load(changes []Change) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.periods = nil
+	t.changes = append([]Change{}, changes...)
+	for i, change := range changes {
+		if i > 0 {
+			until := change.At
+			t.periods[len(t.periods)-1].Until = &until
+		}
+		t.periods = append(t.periods, Period{
+			LeaderID: change.ToLeaderID,
+			LeaderIP: change.ToIP,
+			Term:     change.Term,
+			From:     change.At,
+		})
+	}
+	t.trim()
+}
+
+// ElectionsSince - counts the elections observed after the given time
+func (t *Timeline) ElectionsSince(since time.Time) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var elections int
+	for _, change := range t.changes {
+		if change.At.After(since) && change.IsElection() {
+			elections++
+		}
+	}
+	return elections
+}
+
+// Periods - returns a copy of every leader period, oldest first
+func (t *Timeline) Periods() []Period {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]Period{}, t.periods...)
+}
+
+// Changes - returns a copy of every leader change, oldest first
+func (t *Timeline) Changes() []Change {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]Change{}, t.changes...)
+}
+
+func (t *Timeline) trim() {
+	if t.limit <= 0 {
+		return
+	}
+	if len(t.changes) > t.limit {
+		t.changes = append([]Change{}, t.changes[len(t.changes)-t.limit:]...)
+	}
+	if len(t.periods) > t.limit {
+		t.periods = append([]Period{}, t.periods[len(t.periods)-t.limit:]...)
+	}
+}
@@ -0,0 +1,122 @@
+package history_test
+
+import (
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timeline", func() {
+	var (
+		timeline *history.Timeline
+		start    time.Time
+	)
+
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	BeforeEach(func() {
+		timeline = history.NewTimeline(3)
+		start = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	Describe("#Record", func() {
+		It("does not count the first observation as a change", func() {
+			_, changed := timeline.Record(history.Observation{At: at(0), LeaderID: "a", LeaderIP: "1.1.1.1", Term: 2})
+			Ω(changed).Should(BeFalse())
+			Ω(timeline.Periods()).Should(Equal([]history.Period{
+				{LeaderID: "a", LeaderIP: "1.1.1.1", Term: 2, From: at(0)},
+			}))
+			Ω(timeline.Changes()).Should(BeEmpty())
+		})
+
+		It("ignores observations of the same leader in the same term", func() {
+			timeline.Record(history.Observation{At: at(0), LeaderID: "a", Term: 2})
+			_, changed := timeline.Record(history.Observation{At: at(1), LeaderID: "a", Term: 2})
+			Ω(changed).Should(BeFalse())
+			Ω(timeline.Periods()).Should(HaveLen(1))
+		})
+
+		It("records a change of leader and closes the previous period", func() {
+			timeline.Record(history.Observation{At: at(0), LeaderID: "a", LeaderIP: "1.1.1.1", Term: 2})
+			change, changed := timeline.Record(history.Observation{At: at(1), LeaderID: "b", LeaderIP: "2.2.2.2", Term: 3})
+			Ω(changed).Should(BeTrue())
+			Ω(change).Should(Equal(history.Change{
+				At:           at(1),
+				FromLeaderID: "a",
+				FromIP:       "1.1.1.1",
+				ToLeaderID:   "b",
+				ToIP:         "2.2.2.2",
+				Term:         3,
+			}))
+			periods := timeline.Periods()
+			Ω(periods).Should(HaveLen(2))
+			Ω(*periods[0].Until).Should(Equal(at(1)))
+			Ω(periods[1].Until).Should(BeNil())
+		})
+
+		It("records the same leader being re-elected in a new term", func() {
+			timeline.Record(history.Observation{At: at(0), LeaderID: "a", Term: 2})
+			change, changed := timeline.Record(history.Observation{At: at(1), LeaderID: "a", Term: 3})
+			Ω(changed).Should(BeTrue())
+			Ω(change.IsElection()).Should(BeTrue())
+		})
+
+		It("records losing the leader without counting it as an election", func() {
+			timeline.Record(history.Observation{At: at(0), LeaderID: "a"})
+			change, changed := timeline.Record(history.Observation{At: at(1)})
+			Ω(changed).Should(BeTrue())
+			Ω(change.IsElection()).Should(BeFalse())
+		})
+
+		It("keeps at most the limit of periods and changes", func() {
+			for i, leader := range []string{"a", "b", "c", "d", "e"} {
+				timeline.Record(history.Observation{At: at(i), LeaderID: leader})
+			}
+			Ω(timeline.Changes()).Should(HaveLen(3))
+			Ω(timeline.Changes()[0].ToLeaderID).Should(Equal("c"))
+			Ω(timeline.Periods()).Should(HaveLen(3))
+			Ω(timeline.Periods()[0].LeaderID).Should(Equal("c"))
+		})
+	})
+
+	Describe("#Load", func() {
+		It("rebuilds the periods from stored changes", func() {
+			timeline.Load([]history.Change{
+				{At: at(1), FromLeaderID: "a", ToLeaderID: "b", ToIP: "2.2.2.2", Term: 3},
+				{At: at(5), FromLeaderID: "b", ToLeaderID: "c", ToIP: "3.3.3.3", Term: 4},
+			})
+			periods := timeline.Periods()
+			Ω(periods).Should(HaveLen(2))
+			Ω(periods[0].LeaderID).Should(Equal("b"))
+			Ω(*periods[0].Until).Should(Equal(at(5)))
+			Ω(periods[1].LeaderID).Should(Equal("c"))
+			Ω(periods[1].Until).Should(BeNil())
+			Ω(timeline.ElectionsSince(at(0))).Should(Equal(2))
+		})
+
+		It("continues from the loaded leader", func() {
+			timeline.Load([]history.Change{{At: at(1), FromLeaderID: "a", ToLeaderID: "b", Term: 3}})
+			_, changed := timeline.Record(history.Observation{At: at(2), LeaderID: "b", Term: 3})
+			Ω(changed).Should(BeFalse())
+		})
+	})
+
+	Describe("#ElectionsSince", func() {
+		BeforeEach(func() {
+			timeline.Record(history.Observation{At: at(0), LeaderID: "a"})
+			timeline.Record(history.Observation{At: at(1), LeaderID: "b"})
+			timeline.Record(history.Observation{At: at(2)})
+			timeline.Record(history.Observation{At: at(3), LeaderID: "a"})
+		})
+
+		It("counts elections after the given time", func() {
+			Ω(timeline.ElectionsSince(at(0))).Should(Equal(2))
+			Ω(timeline.ElectionsSince(at(1))).Should(Equal(1))
+			Ω(timeline.ElectionsSince(at(3))).Should(Equal(0))
+		})
+	})
+})
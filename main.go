@@ -1,34 +1,69 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
 	webs "github.com/FidelityInternational/etcd-leader-monitor/web_server"
 	"github.com/cloudfoundry-community/gogobosh"
 	"net/http"
 	"os"
+	"time"
 )
 
 func main() {
-	boshConfig := &gogobosh.Config{
-		Username:          os.Getenv("BOSH_USERNAME"),
-		Password:          os.Getenv("BOSH_PASSWORD"),
-		BOSHAddress:       os.Getenv("BOSH_URI"),
-		SkipSslValidation: true,
-	}
-	boshClient, err := gogobosh.NewClient(boshConfig)
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or JSON config file, overridden by environment variables")
+	flag.Parse()
+
+	config, err := webs.LoadConfig(*configPath)
 	if err != nil {
-		fmt.Println("Could not create bosh client")
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	server := webs.CreateServer(boshClient, &http.Client{})
+	// the gogobosh client only serves LoadCerts, clusters are discovered through a client per director built from the config
+	var boshClient *gogobosh.Client
+	if len(config.Directors) == 0 && config.UsesBOSH() {
+		boshConfig := &gogobosh.Config{
+			Username:          config.BoshUsername,
+			Password:          config.BoshPassword,
+			BOSHAddress:       config.BoshURI,
+			SkipSslValidation: config.BoshSkipSSLValidation,
+		}
+		boshClient, err = gogobosh.NewClient(boshConfig)
+		if err != nil {
+			fmt.Println("Could not create bosh client")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	server := webs.CreateServer(boshClient, &http.Client{Timeout: 10 * time.Second})
+	server.Controller.Config = config
+
+	if config.StorePath != "" {
+		fileStore, err := store.NewFileStore(config.StorePath, config.StoreRetention)
+		if err != nil {
+			fmt.Println("Could not open state store")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := server.Controller.UseStore(fileStore, config.StoreRetention); err != nil {
+			fmt.Println("Could not load history from state store")
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	server.Controller.ConfigureAlerts(config)
+	go server.Controller.Poll(context.Background(), config.PollInterval)
+	go server.Controller.PollDiscovery(context.Background(), config.DiscoveryInterval)
 
 	router := server.Start()
 
 	http.Handle("/", router)
 
-	err = http.ListenAndServe(":"+os.Getenv("PORT"), nil)
+	err = http.ListenAndServe(":"+config.Port, nil)
 	if err != nil {
 		fmt.Println("ListenAndServe:", err)
 	}
@@ -0,0 +1,131 @@
+package maintenance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window - a recurring maintenance window, starting whenever a cron-like schedule matches and lasting for a duration
+type Window struct {
+	Spec     string
+	Duration time.Duration
+	fields   [5]field
+}
+
+// field - the values a single cron field matches
+type field map[int]bool
+
+// bounds - the values allowed for minute, hour, day of month, month and day of week
+var bounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// Parse - parses a window written as a five field cron schedule followed by a duration, such as "0 2 * * 0 2h"
+// for two hours from 02:00 UTC every Sunday. Fields accept *, values, ranges, lists and steps.
+func Parse(spec string) (Window, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 6 {
+		return Window{}, fmt.Errorf("maintenance window %q must be a five field cron schedule and a duration", spec)
+	}
+	duration, err := time.ParseDuration(parts[5])
+	if err != nil || duration <= 0 {
+		return Window{}, fmt.Errorf("maintenance window %q has an invalid duration %q", spec, parts[5])
+	}
+	window := Window{Spec: spec, Duration: duration}
+	for i := range window.fields {
+		window.fields[i], err = parseField(parts[i], bounds[i][0], bounds[i][1])
+		if err != nil {
+			return Window{}, fmt.Errorf("maintenance window %q: %v", spec, err)
+		}
+	}
+	// Sunday may be written as 0 or 7
+	if window.fields[4][7] {
+		window.fields[4][0] = true
+	}
+	return window, nil
+}
+
+// ParseAll - parses every window, ignoring blank entries
+func ParseAll(specs []string) ([]Window, error) {
+	var windows []Window
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		window, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseField(expression string, min int, max int) (field, error) {
+	values := field{}
+	for _, item := range strings.Split(expression, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+			item = item[:i]
+		}
+		from, to := min, max
+		if item != "*" {
+			var err error
+			ends := strings.SplitN(item, "-", 2)
+			if from, err = strconv.Atoi(ends[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			to = from
+			if len(ends) == 2 {
+				if to, err = strconv.Atoi(ends[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", item)
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%q is outside %d-%d", item, min, max)
+		}
+		for value := from; value <= to; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+// starts - whether the window's schedule matches the minute
+func (w Window) starts(t time.Time) bool {
+	return w.fields[0][t.Minute()] &&
+		w.fields[1][t.Hour()] &&
+		w.fields[2][t.Day()] &&
+		w.fields[3][int(t.Month())] &&
+		w.fields[4][int(t.Weekday())]
+}
+
+// Active - whether the window started within its duration before t, schedules are evaluated in UTC
+func (w Window) Active(t time.Time) bool {
+	t = t.UTC()
+	end := t.Truncate(time.Minute)
+	for start := end; t.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if w.starts(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Active - returns the first of the windows active at t
+func Active(windows []Window, t time.Time) (Window, bool) {
+	for _, window := range windows {
+		if window.Active(t) {
+			return window, true
+		}
+	}
+	return Window{}, false
+}
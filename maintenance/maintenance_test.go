@@ -0,0 +1,77 @@
+package maintenance_test
+
+import (
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/maintenance"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Maintenance", func() {
+	// 2017-01-01 was a Sunday
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2017, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	Describe("#Parse", func() {
+		It("rejects a window without a duration", func() {
+			_, err := maintenance.Parse("0 2 * * 0")
+			Ω(err).Should(MatchError(`maintenance window "0 2 * * 0" must be a five field cron schedule and a duration`))
+		})
+
+		It("rejects an invalid duration", func() {
+			_, err := maintenance.Parse("0 2 * * 0 forever")
+			Ω(err).Should(MatchError(`maintenance window "0 2 * * 0 forever" has an invalid duration "forever"`))
+		})
+
+		It("rejects values outside a field's range", func() {
+			_, err := maintenance.Parse("0 24 * * 0 1h")
+			Ω(err).Should(MatchError(`maintenance window "0 24 * * 0 1h": "24" is outside 0-23`))
+		})
+	})
+
+	Describe("#Active", func() {
+		It("is active from the scheduled start for the duration", func() {
+			window, err := maintenance.Parse("30 2 * * 0 2h")
+			Ω(err).Should(BeNil())
+			Ω(window.Active(at(1, 2, 29))).Should(BeFalse())
+			Ω(window.Active(at(1, 2, 30))).Should(BeTrue())
+			Ω(window.Active(at(1, 4, 29))).Should(BeTrue())
+			Ω(window.Active(at(1, 4, 30))).Should(BeFalse())
+			Ω(window.Active(at(2, 3, 0))).Should(BeFalse())
+		})
+
+		It("accepts Sunday as 7", func() {
+			window, err := maintenance.Parse("0 0 * * 7 1h")
+			Ω(err).Should(BeNil())
+			Ω(window.Active(at(1, 0, 10))).Should(BeTrue())
+		})
+
+		It("spans midnight", func() {
+			window, err := maintenance.Parse("0 23 * * 1-5 3h")
+			Ω(err).Should(BeNil())
+			Ω(window.Active(at(3, 1, 0))).Should(BeTrue())
+			Ω(window.Active(at(1, 1, 0))).Should(BeFalse())
+		})
+
+		It("supports lists and steps", func() {
+			window, err := maintenance.Parse("*/15 8,20 1 1 * 5m")
+			Ω(err).Should(BeNil())
+			Ω(window.Active(at(1, 8, 47))).Should(BeTrue())
+			Ω(window.Active(at(1, 20, 14))).Should(BeFalse())
+			Ω(window.Active(at(2, 8, 0))).Should(BeFalse())
+		})
+
+		It("returns the first active window", func() {
+			windows, err := maintenance.ParseAll([]string{"0 2 * * 0 1h", " ", "0 3 * * * 1h"})
+			Ω(err).Should(BeNil())
+			Ω(windows).Should(HaveLen(2))
+			window, ok := maintenance.Active(windows, at(2, 3, 30))
+			Ω(ok).Should(BeTrue())
+			Ω(window.Spec).Should(Equal("0 3 * * * 1h"))
+			_, ok = maintenance.Active(windows, at(2, 5, 0))
+			Ω(ok).Should(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	kindGauge     = "gauge"
+	kindCounter   = "counter"
+	kindHistogram = "histogram"
+)
+
+// Registry - holds metric families and renders them in the Prometheus text exposition format
+type Registry struct {
+	mutex    sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues  []string
+	value        float64
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+// NewRegistry - returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+// NewGauge - registers a gauge that can be set to any value
+func (r *Registry) NewGauge(name string, help string, labels ...string) {
+	r.register(&family{name: name, help: help, kind: kindGauge, labels: labels})
+}
+
+// NewCounter - registers a counter that only ever increases
+func (r *Registry) NewCounter(name string, help string, labels ...string) {
+	r.register(&family{name: name, help: help, kind: kindCounter, labels: labels})
+}
+
+// NewHistogram - registers a histogram with the given upper bucket bounds
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	r.register(&family{name: name, help: help, kind: kindHistogram, labels: labels, buckets: sorted})
+}
+
+// Set - sets a gauge to the given value
+func (r *Registry) Set(name string, value float64, labelValues ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.series(name, kindGauge, labelValues).value = value
+}
+
+// Add - increases a counter by the given amount
+func (r *Registry) Add(name string, delta float64, labelValues ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.series(name, kindCounter, labelValues).value += delta
+}
+
+// Observe - records a single observation in a histogram
+func (r *Registry) Observe(name string, value float64, labelValues ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.series(name, kindHistogram, labelValues)
+	buckets := r.byName[name].buckets
+	for i, bound := range buckets {
+		if value <= bound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Reset - removes every series of a metric whose leading label values match those given, or every series when none
+// are given, used for gauges describing things that may disappear
+func (r *Registry) Reset(name string, labelValues ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	f := r.lookup(name, "")
+	for key, s := range f.series {
+		if hasPrefix(s.labelValues, labelValues) {
+			delete(f.series, key)
+		}
+	}
+}
+
+func hasPrefix(labelValues []string, prefix []string) bool {
+	if len(prefix) > len(labelValues) {
+		return false
+	}
+	for i, value := range prefix {
+		if labelValues[i] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ServeHTTP - renders every metric in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	r.Write(w)
+}
+
+// Write - writes every metric in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, f := range r.families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := f.write(w, f.series[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Registry) register(f *family) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.byName[f.name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", f.name))
+	}
+	f.series = make(map[string]*series)
+	r.families = append(r.families, f)
+	r.byName[f.name] = f
+}
+
+func (r *Registry) lookup(name string, kind string) *family {
+	f, ok := r.byName[name]
+	if !ok {
+		panic(fmt.Sprintf("metric %s is not registered", name))
+	}
+	if kind != "" && f.kind != kind {
+		panic(fmt.Sprintf("metric %s is a %s, not a %s", name, f.kind, kind))
+	}
+	return f
+}
+
+func (r *Registry) series(name string, kind string, labelValues []string) *series {
+	f := r.lookup(name, kind)
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{
+			labelValues:  append([]string{}, labelValues...),
+			bucketCounts: make([]uint64, len(f.buckets)),
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(w io.Writer, s *series) error {
+	if f.kind != kindHistogram {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.labelValues, "", ""), formatFloat(s.value))
+		return err
+	}
+	for i, bound := range f.buckets {
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, "le", formatFloat(bound)), s.bucketCounts[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, "le", "+Inf"), s.count); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(s.labelValues, "", ""), formatFloat(s.sum)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(s.labelValues, "", ""), s.count)
+	return err
+}
+
+func (f *family) labelString(labelValues []string, extraName string, extraValue string) string {
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escape(labelValues[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,257 @@
+package metrics_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		registry *metrics.Registry
+		output   string
+	)
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+	})
+
+	JustBeforeEach(func() {
+		var buffer bytes.Buffer
+		Ω(registry.Write(&buffer)).Should(Succeed())
+		output = buffer.String()
+	})
+
+	Context("with a gauge", func() {
+		BeforeEach(func() {
+			registry.NewGauge("test_gauge", "A test gauge.", "name")
+			registry.Set("test_gauge", 1.5, `a "quoted" value`)
+			registry.Set("test_gauge", 2, "b")
+		})
+
+		It("renders each series with escaped labels", func() {
+			Ω(output).Should(Equal(`# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{name="a \"quoted\" value"} 1.5
+test_gauge{name="b"} 2
+`))
+		})
+
+		Context("that has been reset", func() {
+			BeforeEach(func() {
+				registry.Reset("test_gauge")
+			})
+
+			It("renders no series", func() {
+				Ω(output).Should(Equal("# HELP test_gauge A test gauge.\n# TYPE test_gauge gauge\n"))
+			})
+		})
+
+		Context("that has been reset for one label value", func() {
+			BeforeEach(func() {
+				registry.Reset("test_gauge", "b")
+			})
+
+			It("renders the other series", func() {
+				Ω(output).Should(ContainSubstring(`test_gauge{name="a \"quoted\" value"} 1.5`))
+				Ω(output).ShouldNot(ContainSubstring(`test_gauge{name="b"}`))
+			})
+		})
+	})
+
+	Context("with a counter", func() {
+		BeforeEach(func() {
+			registry.NewCounter("test_total", "A test counter.")
+			registry.Add("test_total", 1)
+			registry.Add("test_total", 2)
+		})
+
+		It("renders the accumulated value", func() {
+			Ω(output).Should(ContainSubstring("# TYPE test_total counter\ntest_total 3\n"))
+		})
+	})
+
+	Context("with a histogram", func() {
+		BeforeEach(func() {
+			registry.NewHistogram("test_seconds", "A test histogram.", []float64{1, 0.5})
+			registry.Observe("test_seconds", 0.2)
+			registry.Observe("test_seconds", 0.7)
+			registry.Observe("test_seconds", 3)
+		})
+
+		It("renders cumulative buckets, sum and count", func() {
+			Ω(output).Should(Equal(`# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.5"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 3.9
+test_seconds_count 3
+`))
+		})
+	})
+
+	It("panics when a metric is used with the wrong number of labels", func() {
+		registry.NewGauge("test_gauge", "A test gauge.", "name")
+		Ω(func() { registry.Set("test_gauge", 1) }).Should(Panic())
+	})
+
+	It("panics when a metric is registered twice", func() {
+		registry.NewGauge("test_gauge", "A test gauge.")
+		Ω(func() { registry.NewCounter("test_gauge", "A test counter.") }).Should(Panic())
+	})
+
+	Describe("#ServeHTTP", func() {
+		It("serves the metrics as prometheus text", func() {
+			registry.NewGauge("test_gauge", "A test gauge.")
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://example.com/metrics", nil)
+			registry.ServeHTTP(recorder, req)
+			Ω(recorder.Code).Should(Equal(200))
+			Ω(recorder.Header().Get("Content-Type")).Should(Equal("text/plain; version=0.0.4"))
+			Ω(recorder.Body.String()).Should(ContainSubstring("# TYPE test_gauge gauge"))
+		})
+	})
+})
+
+var _ = Describe("Monitor", func() {
+	var (
+		monitor *metrics.Monitor
+		output  string
+	)
+
+	BeforeEach(func() {
+		monitor = metrics.NewMonitor()
+	})
+
+	JustBeforeEach(func() {
+		var buffer bytes.Buffer
+		Ω(monitor.Write(&buffer)).Should(Succeed())
+		output = buffer.String()
+	})
+
+	Describe("#RecordElections", func() {
+		BeforeEach(func() {
+			monitor.RecordElections("cf", true, 1)
+			monitor.RecordElections("cf", false, 1)
+			monitor.RecordElections("cf", true, 2)
+		})
+
+		It("counts elections and exports the number within the window", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_elections_total{cluster="cf"} 2` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_recent_elections{cluster="cf"} 2` + "\n"))
+		})
+	})
+
+	Describe("#RecordReport", func() {
+		BeforeEach(func() {
+			monitor.RecordReport(health.Report{Cluster: "cf", Deployment: "cf-1", Healthy: true, Nodes: []health.Node{{IP: "1.1.1.1"}}})
+			monitor.RecordReport(health.Report{Cluster: "diego", Healthy: true, Nodes: []health.Node{{IP: "4.4.4.4"}}})
+			monitor.RecordReport(health.Report{
+				Cluster:      "cf",
+				DirectorName: "prod",
+				Director:     "2daf673a-9755-4b4f-aa6d-3632fbed8019",
+				Deployment:   "cf-12345",
+				Job:          "etcd",
+				Healthy:      false,
+				Maintenance:  "BOSH task 42 (create deployment) is processing",
+				Updating:     true,
+				CheckedAt:    time.Unix(1500000000, 0),
+				Problems:     []health.Problem{{Message: health.MessageNodeUnreachable, IP: "2.2.2.2"}},
+				LeaderGroups: []health.LeaderGroup{
+					{LeaderID: "6a0b69a54415a491", Members: []string{"3.3.3.3"}},
+				},
+				Members: []health.Member{
+					{ID: "6a0b69a54415a491"},
+					{ID: "a0294459200078aa"},
+				},
+				Nodes: []health.Node{
+					{IP: "2.2.2.2", JobName: "etcd", Index: 0, Reachable: false, ErrorReason: "timeout", LatencyMS: 3000},
+					{IP: "3.3.3.3", JobName: "etcd", Index: 1, Reachable: true, Leader: true, Followers: 1, LatencyMS: 2, RaftTerm: 4, RaftIndex: 31, FollowerStats: []health.Follower{
+						{ID: "a0294459200078aa", LatencyCurrentMS: 1.5, FailCount: 16, SuccessCount: 2000, Degraded: true},
+					}},
+				},
+			})
+		})
+
+		It("exports cluster gauges from the latest report", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_cluster_healthy{cluster="cf"} 0` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_cluster_raw_healthy{cluster="cf"} 0` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_maintenance{cluster="cf"} 1` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_updating{cluster="cf"} 1` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_leaders{cluster="cf"} 1` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_leader_groups{cluster="cf"} 1` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_members{cluster="cf"} 2` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_nodes{cluster="cf"} 2` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_nodes_reachable{cluster="cf"} 1` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_last_check_timestamp_seconds{cluster="cf"} 1.5e+09` + "\n"))
+		})
+
+		It("identifies the director, deployment and job of the cluster", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_cluster_info{cluster="cf",director="prod",director_uuid="2daf673a-9755-4b4f-aa6d-3632fbed8019",deployment="cf-12345",job="etcd"} 1`))
+			Ω(output).ShouldNot(ContainSubstring(`deployment="cf-1",`))
+		})
+
+		It("exports node gauges for only the nodes in the latest report", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_node_is_leader{cluster="cf",ip="3.3.3.3",job="etcd",index="1"} 1`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_node_followers{cluster="cf",ip="3.3.3.3",job="etcd",index="1"} 1`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_node_reachable{cluster="cf",ip="2.2.2.2",job="etcd",index="0"} 0`))
+			Ω(output).ShouldNot(ContainSubstring(`etcd_monitor_node_is_leader{cluster="cf",ip="1.1.1.1"`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_node_raft_term{cluster="cf",ip="3.3.3.3",job="etcd",index="1"} 4`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_node_raft_index{cluster="cf",ip="3.3.3.3",job="etcd",index="1"} 31`))
+			Ω(output).ShouldNot(ContainSubstring(`etcd_monitor_node_raft_term{cluster="cf",ip="2.2.2.2"`))
+		})
+
+		It("keeps the node gauges of other clusters", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_node_reachable{cluster="diego",ip="4.4.4.4",job="",index="0"} 0`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_cluster_healthy{cluster="diego"} 1`))
+		})
+
+		It("exports follower gauges for the leader", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_follower_latency_seconds{cluster="cf",leader_ip="3.3.3.3",follower="a0294459200078aa"} 0.0015`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_follower_fail_count{cluster="cf",leader_ip="3.3.3.3",follower="a0294459200078aa"} 16`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_follower_success_count{cluster="cf",leader_ip="3.3.3.3",follower="a0294459200078aa"} 2000`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_follower_degraded{cluster="cf",leader_ip="3.3.3.3",follower="a0294459200078aa"} 1`))
+		})
+
+		It("accumulates probe latencies, errors and problems", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_probe_latency_seconds_count{cluster="cf",ip="1.1.1.1"} 1`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_probe_latency_seconds_bucket{cluster="cf",ip="3.3.3.3",le="0.005"} 1`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_probe_errors_total{cluster="cf",reason="timeout"} 1`))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_problems_total{cluster="cf",message="Node unreachable"} 1`))
+		})
+	})
+
+	Describe("#RecordDiscovery", func() {
+		BeforeEach(func() {
+			monitor.RecordDiscovery("cf", "bosh", 2*time.Second, nil)
+			monitor.RecordDiscovery("cf", "bosh", time.Second, fmt.Errorf("bosh is down"))
+			monitor.RecordDiscovery("k8s", "dns", time.Second, nil)
+		})
+
+		It("records the duration of every discovery and counts failures by mode", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_discovery_duration_seconds_count{cluster="cf",mode="bosh"} 2` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_discovery_duration_seconds_sum{cluster="cf",mode="bosh"} 3` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_discovery_errors_total{cluster="cf",mode="bosh"} 1` + "\n"))
+			Ω(output).Should(ContainSubstring(`etcd_monitor_discovery_duration_seconds_count{cluster="k8s",mode="dns"} 1` + "\n"))
+			Ω(output).ShouldNot(ContainSubstring(`etcd_monitor_discovery_errors_total{cluster="k8s"`))
+		})
+	})
+
+	Describe("#RecordCheckError", func() {
+		BeforeEach(func() {
+			monitor.RecordCheckError("cf")
+		})
+
+		It("counts checks that could not be completed", func() {
+			Ω(output).Should(ContainSubstring(`etcd_monitor_check_errors_total{cluster="cf"} 1` + "\n"))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+)
+
+// Monitor - the metrics exported by the etcd leader monitor
+type Monitor struct {
+	*Registry
+}
+
+// NewMonitor - returns a registry with every monitor metric registered
+func NewMonitor() *Monitor {
+	registry := NewRegistry()
+	registry.NewGauge("etcd_monitor_cluster_info", "Identifies the BOSH director, deployment and job of the etcd cluster, always 1.",
+		"cluster", "director", "director_uuid", "deployment", "job")
+	registry.NewGauge("etcd_monitor_cluster_healthy", "Whether the etcd cluster is confirmed healthy (1) or not (0) as of the last check.", "cluster")
+	registry.NewGauge("etcd_monitor_cluster_raw_healthy", "Whether the last check on its own found the etcd cluster healthy (1) or not (0).", "cluster")
+	registry.NewGauge("etcd_monitor_maintenance", "Whether maintenance was under way at the last check (1) or not (0).", "cluster")
+	registry.NewGauge("etcd_monitor_updating", "Whether BOSH was updating the deployment at the last check (1) or not (0).", "cluster")
+	registry.NewGauge("etcd_monitor_leaders", "Number of etcd nodes claiming leadership at the last check.", "cluster")
+	registry.NewGauge("etcd_monitor_leader_groups", "Number of distinct leaders the etcd nodes believe in at the last check.", "cluster")
+	registry.NewGauge("etcd_monitor_members", "Number of etcd cluster members most nodes agree on at the last check.", "cluster")
+	registry.NewGauge("etcd_monitor_nodes", "Number of etcd nodes discovered at the last check.", "cluster")
+	registry.NewGauge("etcd_monitor_nodes_reachable", "Number of etcd nodes that answered at the last check.", "cluster")
+	registry.NewGauge("etcd_monitor_last_check_timestamp_seconds", "Unix time of the last completed check.", "cluster")
+	registry.NewGauge("etcd_monitor_node_is_leader", "Whether the etcd node claims leadership (1) or not (0).", "cluster", "ip", "job", "index")
+	registry.NewGauge("etcd_monitor_node_followers", "Number of followers reported by the etcd node.", "cluster", "ip", "job", "index")
+	registry.NewGauge("etcd_monitor_node_reachable", "Whether the etcd node answered the last probe (1) or not (0).", "cluster", "ip", "job", "index")
+	registry.NewGauge("etcd_monitor_node_raft_term", "Raft term reported by the etcd node.", "cluster", "ip", "job", "index")
+	registry.NewGauge("etcd_monitor_node_raft_index", "Raft index reported by the etcd node.", "cluster", "ip", "job", "index")
+	registry.NewGauge("etcd_monitor_follower_latency_seconds", "Current latency from the leader to the follower.", "cluster", "leader_ip", "follower")
+	registry.NewGauge("etcd_monitor_follower_fail_count", "Failed raft messages from the leader to the follower since the leader was elected.", "cluster", "leader_ip", "follower")
+	registry.NewGauge("etcd_monitor_follower_success_count", "Successful raft messages from the leader to the follower since the leader was elected.", "cluster", "leader_ip", "follower")
+	registry.NewGauge("etcd_monitor_follower_degraded", "Whether the follower exceeds the latency or failure thresholds (1) or not (0).", "cluster", "leader_ip", "follower")
+	registry.NewHistogram("etcd_monitor_probe_latency_seconds", "Latency of etcd leader probes.",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, "cluster", "ip")
+	registry.NewCounter("etcd_monitor_probe_errors_total", "Failed etcd probes by reason.", "cluster", "reason")
+	registry.NewCounter("etcd_monitor_problems_total", "Problems detected by checks, by message.", "cluster", "message")
+	registry.NewCounter("etcd_monitor_elections_total", "Leader elections observed between checks.", "cluster")
+	registry.NewGauge("etcd_monitor_recent_elections", "Leader elections observed within the flapping window.", "cluster")
+	registry.NewCounter("etcd_monitor_check_errors_total", "Checks that could not be completed.", "cluster")
+	registry.NewHistogram("etcd_monitor_discovery_duration_seconds", "Time taken to discover etcd endpoints, by discovery mode.",
+		[]float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60}, "cluster", "mode")
+	registry.NewCounter("etcd_monitor_discovery_errors_total", "Discoveries of etcd endpoints that failed, by discovery mode.", "cluster", "mode")
+	return &Monitor{Registry: registry}
+}
+
+// RecordReport - updates the metrics of the report's cluster and its nodes from a completed check, leaving other clusters alone
+func (m *Monitor) RecordReport(report health.Report) {
+	var leaders, reachable int
+
+	m.Reset("etcd_monitor_cluster_info", report.Cluster)
+	m.Set("etcd_monitor_cluster_info", 1, report.Cluster, report.DirectorName, report.Director, report.Deployment, report.Job)
+	m.Reset("etcd_monitor_node_is_leader", report.Cluster)
+	m.Reset("etcd_monitor_node_followers", report.Cluster)
+	m.Reset("etcd_monitor_node_reachable", report.Cluster)
+	m.Reset("etcd_monitor_node_raft_term", report.Cluster)
+	m.Reset("etcd_monitor_node_raft_index", report.Cluster)
+	m.Reset("etcd_monitor_follower_latency_seconds", report.Cluster)
+	m.Reset("etcd_monitor_follower_fail_count", report.Cluster)
+	m.Reset("etcd_monitor_follower_success_count", report.Cluster)
+	m.Reset("etcd_monitor_follower_degraded", report.Cluster)
+	for _, node := range report.Nodes {
+		labels := []string{report.Cluster, node.IP, node.JobName, strconv.Itoa(node.Index)}
+		m.Set("etcd_monitor_node_is_leader", boolFloat(node.Leader), labels...)
+		m.Set("etcd_monitor_node_followers", float64(node.Followers), labels...)
+		m.Set("etcd_monitor_node_reachable", boolFloat(node.Reachable), labels...)
+		if node.RaftTerm > 0 {
+			m.Set("etcd_monitor_node_raft_term", float64(node.RaftTerm), labels...)
+			m.Set("etcd_monitor_node_raft_index", float64(node.RaftIndex), labels...)
+		}
+		m.Observe("etcd_monitor_probe_latency_seconds", node.LatencyMS/1000, report.Cluster, node.IP)
+		for _, follower := range node.FollowerStats {
+			m.Set("etcd_monitor_follower_latency_seconds", follower.LatencyCurrentMS/1000, report.Cluster, node.IP, follower.ID)
+			m.Set("etcd_monitor_follower_fail_count", float64(follower.FailCount), report.Cluster, node.IP, follower.ID)
+			m.Set("etcd_monitor_follower_success_count", float64(follower.SuccessCount), report.Cluster, node.IP, follower.ID)
+			m.Set("etcd_monitor_follower_degraded", boolFloat(follower.Degraded), report.Cluster, node.IP, follower.ID)
+		}
+		if node.Leader {
+			leaders++
+		}
+		if node.Reachable {
+			reachable++
+		} else {
+			m.Add("etcd_monitor_probe_errors_total", 1, report.Cluster, node.ErrorReason)
+		}
+	}
+	for _, problem := range report.Problems {
+		m.Add("etcd_monitor_problems_total", 1, report.Cluster, problem.Message)
+	}
+	m.Set("etcd_monitor_cluster_healthy", boolFloat(report.Healthy), report.Cluster)
+	m.Set("etcd_monitor_cluster_raw_healthy", boolFloat(report.RawHealthy), report.Cluster)
+	m.Set("etcd_monitor_maintenance", boolFloat(report.Maintenance != ""), report.Cluster)
+	m.Set("etcd_monitor_updating", boolFloat(report.Updating), report.Cluster)
+	m.Set("etcd_monitor_leaders", float64(leaders), report.Cluster)
+	m.Set("etcd_monitor_leader_groups", float64(len(report.LeaderGroups)), report.Cluster)
+	m.Set("etcd_monitor_members", float64(len(report.Members)), report.Cluster)
+	m.Set("etcd_monitor_nodes", float64(len(report.Nodes)), report.Cluster)
+	m.Set("etcd_monitor_nodes_reachable", float64(reachable), report.Cluster)
+	m.Set("etcd_monitor_last_check_timestamp_seconds", float64(report.CheckedAt.UnixNano())/1e9, report.Cluster)
+}
+
+// RecordElections - counts an election observed by the latest check of a cluster and the number within the flapping window
+func (m *Monitor) RecordElections(cluster string, elected bool, recent int) {
+	if elected {
+		m.Add("etcd_monitor_elections_total", 1, cluster)
+	}
+	m.Set("etcd_monitor_recent_elections", float64(recent), cluster)
+}
+
+// RecordCheckError - counts a check of a cluster that could not be completed
+func (m *Monitor) RecordCheckError(cluster string) {
+	m.Add("etcd_monitor_check_errors_total", 1, cluster)
+}
+
+// RecordDiscovery - records how long a discovery of a cluster's endpoints through the given mode took and whether it failed
+func (m *Monitor) RecordDiscovery(cluster string, mode string, duration time.Duration, err error) {
+	m.Observe("etcd_monitor_discovery_duration_seconds", duration.Seconds(), cluster, mode)
+	if err != nil {
+		m.Add("etcd_monitor_discovery_errors_total", 1, cluster, mode)
+	}
+}
+
+func boolFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+)
+
+const (
+	checksFile  = "checks.jsonl"
+	changesFile = "changes.jsonl"
+	alertsFile  = "alerts.jsonl"
+	lockName    = "store.lock"
+)
+
+// pruneInterval - how often records older than the retention are removed
+const pruneInterval = time.Hour
+
+// FileStore - a store keeping one JSON record per line in files under a directory, such as a volume service mount
+type FileStore struct {
+	mutex     sync.Mutex
+	path      string
+	retention time.Duration
+	lastPrune time.Time
+}
+
+// NewFileStore - returns a store writing to the directory at path, creating it if needed,
+// records older than retention are removed, zero keeps every record
+func NewFileStore(path string, retention time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{path: path, retention: retention}
+	if err := s.Prune(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveCheck - appends a check result
+func (s *FileStore) SaveCheck(check Check) error {
+	return s.append(checksFile, check)
+}
+
+// SaveChange - appends a leader change
+func (s *FileStore) SaveChange(change history.Change) error {
+	return s.append(changesFile, change)
+}
+
+// SaveAlert - appends an alert
+func (s *FileStore) SaveAlert(alert Alert) error {
+	return s.append(alertsFile, alert)
+}
+
+// Checks - returns the check results recorded after since, oldest first
+func (s *FileStore) Checks(since time.Time) ([]Check, error) {
+	checks := []Check{}
+	err := s.read(checksFile, since, func(line []byte) error {
+		var check Check
+		if err := json.Unmarshal(line, &check); err != nil {
+			return err
+		}
+		checks = append(checks, check)
+		return nil
+	})
+	return checks, err
+}
+
+// Changes - returns the leader changes recorded after since, oldest first, collapsing the same change
+// recorded by more than one instance
+func (s *FileStore) Changes(since time.Time) ([]history.Change, error) {
+	changes := []history.Change{}
+	err := s.read(changesFile, since, func(line []byte) error {
+		var change history.Change
+		if err := json.Unmarshal(line, &change); err != nil {
+			return err
+		}
+		if len(changes) > 0 && sameChange(changes[len(changes)-1], change) {
+			return nil
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	return changes, err
+}
+
+// Alerts - returns the alerts recorded after since, oldest first
+func (s *FileStore) Alerts(since time.Time) ([]Alert, error) {
+	alerts := []Alert{}
+	err := s.read(alertsFile, since, func(line []byte) error {
+		var alert Alert
+		if err := json.Unmarshal(line, &alert); err != nil {
+			return err
+		}
+		alerts = append(alerts, alert)
+		return nil
+	})
+	return alerts, err
+}
+
+// Prune - removes records older than the retention from every file
+func (s *FileStore) Prune() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.locked(s.prune)
+}
+
+func (s *FileStore) append(name string, record interface{}) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.locked(func() error {
+		if s.retention > 0 && time.Now().Sub(s.lastPrune) > pruneInterval {
+			if err := s.prune(); err != nil {
+				fmt.Printf("Could not prune the state store: %v\n", err)
+			}
+		}
+		file, err := os.OpenFile(filepath.Join(s.path, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+}
+
+// locked - calls fn holding the lock file of the directory, so that an instance sharing the directory cannot append
+// a record between another instance reading a file to prune it and replacing it
+func (s *FileStore) locked(fn func() error) error {
+	file, err := os.OpenFile(filepath.Join(s.path, lockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := lockFile(file); err != nil {
+		return fmt.Errorf("could not lock the state store: %v", err)
+	}
+	defer unlockFile(file)
+	return fn()
+}
+
+// read - calls decode for each line recorded after since, skipping lines that cannot be parsed,
+// such as a line cut short when an instance stopped mid-write
+func (s *FileStore) read(name string, since time.Time, decode func([]byte) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.scan(name, func(at time.Time, line []byte) error {
+		if !at.After(since) {
+			return nil
+		}
+		return decode(line)
+	})
+}
+
+func (s *FileStore) scan(name string, each func(time.Time, []byte) error) error {
+	file, err := os.Open(filepath.Join(s.path, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record struct {
+			At time.Time `json:"at"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if err := each(record.At, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// prune - rewrites each file without the expired records, replacing it atomically
+func (s *FileStore) prune() error {
+	s.lastPrune = time.Now()
+	if s.retention <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for _, name := range []string{checksFile, changesFile, alertsFile} {
+		var kept []byte
+		expired := false
+		err := s.scan(name, func(at time.Time, line []byte) error {
+			if at.Before(cutoff) {
+				expired = true
+				return nil
+			}
+			kept = append(append(kept, line...), '\n')
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !expired {
+			continue
+		}
+		temp := filepath.Join(s.path, name+".tmp")
+		if err := ioutil.WriteFile(temp, kept, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(temp, filepath.Join(s.path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameChange(a history.Change, b history.Change) bool {
+	return a.Cluster == b.Cluster && a.FromLeaderID == b.FromLeaderID && a.ToLeaderID == b.ToLeaderID && a.Term == b.Term
+}
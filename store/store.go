@@ -0,0 +1,53 @@
+package store
+
+import (
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+)
+
+// Store - persists check results, leader changes and alerts so they survive restarts and are shared between instances
+type Store interface {
+	SaveCheck(check Check) error
+	SaveChange(change history.Change) error
+	SaveAlert(alert Alert) error
+	Checks(since time.Time) ([]Check, error)
+	Changes(since time.Time) ([]history.Change, error)
+	Alerts(since time.Time) ([]Alert, error)
+}
+
+// Check - the outcome of a single check, without the node table
+type Check struct {
+	At       time.Time        `json:"at"`
+	Cluster  string           `json:"cluster,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Healthy  bool             `json:"healthy"`
+	Message  string           `json:"message"`
+	Problems []health.Problem `json:"problems"`
+}
+
+// Alert - a notification sent, or attempted, about a change in the cluster's health
+type Alert struct {
+	At        time.Time `json:"at"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Instance  string    `json:"instance,omitempty"`
+	Notifier  string    `json:"notifier"`
+	Target    string    `json:"target"`
+	Healthy   bool      `json:"healthy"`
+	Message   string    `json:"message"`
+	Delivered bool      `json:"delivered"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// CheckFromReport - summarises a report for storage
+func CheckFromReport(report health.Report, instance string) Check {
+	return Check{
+		At:       report.CheckedAt,
+		Cluster:  report.Cluster,
+		Instance: instance,
+		Healthy:  report.Healthy,
+		Message:  report.Message,
+		Problems: report.Problems,
+	}
+}
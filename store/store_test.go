@@ -0,0 +1,150 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileStore", func() {
+	var (
+		dir       string
+		fileStore *store.FileStore
+		now       time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "store")
+		Ω(err).Should(BeNil())
+		now = time.Now().UTC().Truncate(time.Second)
+		fileStore, err = store.NewFileStore(filepath.Join(dir, "state"), 24*time.Hour)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("#CheckFromReport", func() {
+		It("keeps the verdict and problems without the nodes", func() {
+			check := store.CheckFromReport(health.Report{
+				CheckedAt: now,
+				Healthy:   false,
+				Message:   health.MessageNodeUnreachable,
+				Problems:  []health.Problem{{Message: health.MessageNodeUnreachable, IP: "1.1.1.1"}},
+				Nodes:     []health.Node{{IP: "1.1.1.1"}},
+			}, "1")
+			Ω(check).Should(Equal(store.Check{
+				At:       now,
+				Instance: "1",
+				Message:  health.MessageNodeUnreachable,
+				Problems: []health.Problem{{Message: health.MessageNodeUnreachable, IP: "1.1.1.1"}},
+			}))
+		})
+	})
+
+	Describe("checks", func() {
+		BeforeEach(func() {
+			Ω(fileStore.SaveCheck(store.Check{At: now.Add(-2 * time.Hour), Healthy: true, Message: health.MessageHealthy})).Should(Succeed())
+			Ω(fileStore.SaveCheck(store.Check{At: now.Add(-time.Minute), Healthy: false, Message: health.MessageQuorumLost})).Should(Succeed())
+		})
+
+		It("returns the checks after the given time, oldest first", func() {
+			checks, err := fileStore.Checks(now.Add(-3 * time.Hour))
+			Ω(err).Should(BeNil())
+			Ω(checks).Should(HaveLen(2))
+			Ω(checks[0].Message).Should(Equal(health.MessageHealthy))
+
+			checks, err = fileStore.Checks(now.Add(-time.Hour))
+			Ω(err).Should(BeNil())
+			Ω(checks).Should(HaveLen(1))
+			Ω(checks[0].Message).Should(Equal(health.MessageQuorumLost))
+		})
+
+		It("survives reopening the store", func() {
+			reopened, err := store.NewFileStore(filepath.Join(dir, "state"), 24*time.Hour)
+			Ω(err).Should(BeNil())
+			checks, err := reopened.Checks(time.Time{})
+			Ω(err).Should(BeNil())
+			Ω(checks).Should(HaveLen(2))
+		})
+
+		It("skips lines that cannot be parsed", func() {
+			file, err := os.OpenFile(filepath.Join(dir, "state", "checks.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+			Ω(err).Should(BeNil())
+			file.WriteString("{\"at\":\"2017-01\n")
+			file.Close()
+			checks, err := fileStore.Checks(time.Time{})
+			Ω(err).Should(BeNil())
+			Ω(checks).Should(HaveLen(2))
+		})
+	})
+
+	Describe("changes", func() {
+		It("collapses the same change recorded by more than one instance", func() {
+			change := history.Change{At: now.Add(-time.Minute), FromLeaderID: "a", ToLeaderID: "b", Term: 3}
+			Ω(fileStore.SaveChange(change)).Should(Succeed())
+			change.At = now.Add(-time.Minute + time.Second)
+			Ω(fileStore.SaveChange(change)).Should(Succeed())
+			Ω(fileStore.SaveChange(history.Change{At: now, FromLeaderID: "b", ToLeaderID: "a", Term: 4})).Should(Succeed())
+
+			changes, err := fileStore.Changes(time.Time{})
+			Ω(err).Should(BeNil())
+			Ω(changes).Should(HaveLen(2))
+			Ω(changes[1].ToLeaderID).Should(Equal("a"))
+		})
+	})
+
+	Describe("alerts", func() {
+		It("returns the stored alerts", func() {
+			Ω(fileStore.SaveAlert(store.Alert{At: now, Notifier: "webhook", Target: "http://example.com", Message: health.MessageSplitBrain, Delivered: true})).Should(Succeed())
+			alerts, err := fileStore.Alerts(time.Time{})
+			Ω(err).Should(BeNil())
+			Ω(alerts).Should(ConsistOf(store.Alert{At: now, Notifier: "webhook", Target: "http://example.com", Message: health.MessageSplitBrain, Delivered: true}))
+		})
+	})
+
+	Describe("#Prune", func() {
+		It("removes records older than the retention", func() {
+			Ω(fileStore.SaveCheck(store.Check{At: now.Add(-48 * time.Hour), Message: "old"})).Should(Succeed())
+			Ω(fileStore.SaveCheck(store.Check{At: now.Add(-time.Hour), Message: "recent"})).Should(Succeed())
+			Ω(fileStore.Prune()).Should(Succeed())
+
+			checks, err := fileStore.Checks(time.Time{})
+			Ω(err).Should(BeNil())
+			Ω(checks).Should(HaveLen(1))
+			Ω(checks[0].Message).Should(Equal("recent"))
+		})
+
+		It("keeps the records another instance sharing the directory appends while pruning", func() {
+			other, err := store.NewFileStore(filepath.Join(dir, "state"), 24*time.Hour)
+			Ω(err).Should(BeNil())
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 1000; i++ {
+					other.SaveCheck(store.Check{At: now.Add(-48 * time.Hour), Message: "old"})
+					other.SaveCheck(store.Check{At: now.Add(-time.Hour), Message: "recent"})
+				}
+			}()
+			for i := 0; i < 1000; i++ {
+				Ω(fileStore.Prune()).Should(Succeed())
+			}
+			<-done
+			Ω(fileStore.Prune()).Should(Succeed())
+
+			checks, err := fileStore.Checks(time.Time{})
+			Ω(err).Should(BeNil())
+			Ω(checks).Should(HaveLen(1000))
+		})
+	})
+})
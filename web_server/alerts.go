@@ -0,0 +1,66 @@
+package webServer
+
+import (
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	"net/http"
+	"strings"
+)
+
+// ConfigureAlerts - sends alerts on health transitions to every notifier configured, if any
+func (c *Controller) ConfigureAlerts(deployconfig Config) {
+	notifiers := alertNotifiers(deployconfig)
+	if len(notifiers) == 0 {
+		return
+	}
+	c.Alerts = alert.NewDispatcher(notifiers, alert.Config{
+		MonitorURL:  deployconfig.MonitorURL,
+		Instance:    deployconfig.InstanceIndex,
+		Retries:     deployconfig.AlertRetries,
+		Backoff:     deployconfig.AlertBackoff,
+		Timeout:     deployconfig.AlertTimeout,
+		DedupWindow: deployconfig.AlertDedupWindow,
+		Store:       c.Store,
+	})
+}
+
+// alertNotifiers - builds a notifier for each destination in the config
+func alertNotifiers(deployconfig Config) []alert.Notifier {
+	var notifiers []alert.Notifier
+	httpClient := &http.Client{}
+	for _, url := range urls(deployconfig.WebhookURLs) {
+		notifiers = append(notifiers, alert.NewWebhook(url, httpClient))
+	}
+	for _, url := range urls(deployconfig.SlackWebhookURLs) {
+		notifiers = append(notifiers, alert.NewSlack(url, httpClient))
+	}
+	for _, url := range urls(deployconfig.TeamsWebhookURLs) {
+		notifiers = append(notifiers, alert.NewTeams(url, httpClient))
+	}
+	for _, routingKey := range urls(deployconfig.PagerDutyRoutingKeys) {
+		notifiers = append(notifiers, alert.NewPagerDuty(routingKey, deployconfig.PagerDutyEventsURL, httpClient))
+	}
+	if to := urls(deployconfig.SMTPTo); deployconfig.SMTPHost != "" && len(to) > 0 {
+		notifiers = append(notifiers, &alert.Email{
+			Host:         deployconfig.SMTPHost,
+			Port:         deployconfig.SMTPPort,
+			StartTLS:     deployconfig.SMTPStartTLS,
+			Username:     deployconfig.SMTPUsername,
+			Password:     deployconfig.SMTPPassword,
+			From:         deployconfig.SMTPFrom,
+			To:           to,
+			DigestWindow: deployconfig.SMTPDigestWindow,
+		})
+	}
+	return notifiers
+}
+
+// urls - drops the blanks left by stray separators in a list of URLs or keys
+func urls(list []string) []string {
+	var cleaned []string
+	for _, url := range list {
+		if url = strings.TrimSpace(url); url != "" {
+			cleaned = append(cleaned, url)
+		}
+	}
+	return cleaned
+}
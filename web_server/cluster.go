@@ -0,0 +1,272 @@
+package webServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/discovery"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cluster - a single monitored etcd cluster along with its discovered VMs, cached report, leadership timeline and
+// confirmed verdict. Its settings are looked up by name in the controller's config on every check.
+type Cluster struct {
+	Name          string
+	History       *history.Timeline
+	Confirmer     *health.Confirmer
+	controller    *Controller
+	refreshMutex  sync.Mutex
+	reportMutex   sync.RWMutex
+	lastReport    *health.Report
+	discoverMutex sync.Mutex
+	topologyMutex sync.Mutex
+	topology      *topology
+	rediscovering bool      // whether a background rediscovery is running, guarded by topologyMutex
+	rediscoverErr error     // why the last background rediscovery failed, guarded by topologyMutex
+	attemptedAt   time.Time // when a discovery last started, whether or not it succeeded, guarded by topologyMutex
+	updatedAt     time.Time // when BOSH was last seen updating the deployment, guarded by refreshMutex
+}
+
+// ClusterSummary - the verdict of a single cluster, as listed on /clusters and in the aggregate verdict
+type ClusterSummary struct {
+	Name         string     `json:"name"`
+	DirectorName string     `json:"director,omitempty"`
+	Director     string     `json:"director_uuid,omitempty"`
+	Deployment   string     `json:"deployment,omitempty"`
+	Job          string     `json:"job,omitempty"`
+	Healthy      bool       `json:"healthy"`
+	Message      string     `json:"message"`
+	CheckedAt    *time.Time `json:"checked_at,omitempty"`
+	Stale        bool       `json:"stale"`
+	LastError    string     `json:"last_error,omitempty"`
+	Href         string     `json:"href"`
+}
+
+// Aggregate - the verdict over every monitored cluster served on / when more than one cluster is configured,
+// healthy only when every cluster is
+type Aggregate struct {
+	Healthy  bool             `json:"healthy"`
+	Message  string           `json:"message"`
+	Clusters []ClusterSummary `json:"clusters"`
+}
+
+func newCluster(controller *Controller, name string) *Cluster {
+	return &Cluster{
+		Name:       name,
+		History:    history.NewTimeline(historyLimit),
+		Confirmer:  health.NewConfirmer(),
+		controller: controller,
+	}
+}
+
+// Clusters - the monitored clusters in the order they are configured
+func (c *Controller) Clusters() []*Cluster {
+	c.clustersMutex.Lock()
+	defer c.clustersMutex.Unlock()
+
+	var clusters []*Cluster
+	for _, definition := range c.Config.ClusterDefinitions() {
+		cluster, ok := c.clusters[definition.Name]
+		if !ok {
+			cluster = newCluster(c, definition.Name)
+			c.clusters[definition.Name] = cluster
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// Cluster - returns the monitored cluster with the given name
+func (c *Controller) Cluster(name string) (*Cluster, bool) {
+	for _, cluster := range c.Clusters() {
+		if cluster.Name == name {
+			return cluster, true
+		}
+	}
+	return nil, false
+}
+
+// eachCluster - calls fn with the position of every cluster and the cluster in parallel, so that a slow cluster does
+// not hold up the others, and returns the error of each
+func eachCluster(clusters []*Cluster, fn func(i int, cluster *Cluster) error) []error {
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(clusters))
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func(i int, cluster *Cluster) {
+			defer wg.Done()
+			errs[i] = fn(i, cluster)
+		}(i, cluster)
+	}
+	wg.Wait()
+	return errs
+}
+
+// rounds - the clusters whose scheduled work is still running, so that a slow cluster skips ticks of its own rather
+// than delaying the other clusters until it finishes
+type rounds struct {
+	mutex   sync.Mutex
+	running map[*Cluster]bool
+}
+
+// start - calls fn with every cluster in the background, except the clusters whose previous call is still running
+func (r *rounds) start(clusters []*Cluster, fn func(cluster *Cluster)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.running == nil {
+		r.running = map[*Cluster]bool{}
+	}
+	for _, cluster := range clusters {
+		if r.running[cluster] {
+			fmt.Printf("Skipping cluster %s, its previous round is still running\n", cluster.Name)
+			continue
+		}
+		r.running[cluster] = true
+		go func(cluster *Cluster) {
+			defer r.finish(cluster)
+			fn(cluster)
+		}(cluster)
+	}
+}
+
+func (r *rounds) finish(cluster *Cluster) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.running, cluster)
+}
+
+// definition - the cluster's settings along with the rest of the config
+func (cl *Cluster) definition() (ClusterConfig, Config, error) {
+	deployconfig := cl.controller.Config
+	definition, ok := deployconfig.clusterDefinition(cl.Name)
+	if !ok {
+		return ClusterConfig{}, deployconfig, fmt.Errorf("cluster %s is no longer configured", cl.Name)
+	}
+	return definition, deployconfig, nil
+}
+
+// current - returns the cluster's most recent report annotated with its age, checking the cluster first if none is cached
+func (cl *Cluster) current() (health.Report, error) {
+	report, ok := cl.LastReport()
+	if !ok {
+		var err error
+		report, err = cl.Refresh()
+		if err != nil {
+			return health.Report{}, err
+		}
+	}
+	return withAge(report, time.Now(), cl.controller.Config.StaleAfter), nil
+}
+
+// summarise - the verdict of a cluster, a cluster that could not be checked at all is unhealthy
+func summarise(cluster *Cluster, report health.Report, err error) ClusterSummary {
+	summary := ClusterSummary{
+		Name: cluster.Name,
+		Href: "/clusters/" + cluster.Name,
+	}
+	if definition, _, definitionErr := cluster.definition(); definitionErr == nil && definition.Discovery == discovery.ModeBOSH {
+		summary.DirectorName = definition.Director
+	}
+	if err != nil {
+		summary.Message = health.MessageCheckFailed
+		summary.LastError = err.Error()
+		return summary
+	}
+	summary.DirectorName = report.DirectorName
+	summary.Director = report.Director
+	summary.Deployment = report.Deployment
+	summary.Job = report.Job
+	summary.Healthy = report.Healthy
+	summary.Message = report.Message
+	summary.CheckedAt = &report.CheckedAt
+	summary.Stale = report.Stale
+	summary.LastError = report.LastError
+	return summary
+}
+
+// summaries - the verdict of every cluster, checking those with no cached report in parallel
+func summaries(clusters []*Cluster) ([]ClusterSummary, []error) {
+	reports := make([]health.Report, len(clusters))
+	errs := eachCluster(clusters, func(i int, cluster *Cluster) error {
+		var err error
+		reports[i], err = cluster.current()
+		return err
+	})
+	list := []ClusterSummary{}
+	for i, cluster := range clusters {
+		list = append(list, summarise(cluster, reports[i], errs[i]))
+	}
+	return list, errs
+}
+
+// aggregate - the verdict over every cluster, failing only when no cluster could be checked
+func aggregate(clusters []*Cluster) (Aggregate, error) {
+	list, errs := summaries(clusters)
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == len(clusters) && failed > 0 {
+		return Aggregate{}, errs[0]
+	}
+
+	var unhealthy []string
+	for _, summary := range list {
+		if !summary.Healthy {
+			unhealthy = append(unhealthy, summary.Name)
+		}
+	}
+	result := Aggregate{
+		Healthy:  len(unhealthy) == 0,
+		Message:  health.MessageHealthy,
+		Clusters: list,
+	}
+	if !result.Healthy {
+		result.Message = fmt.Sprintf("Unhealthy clusters: %s", strings.Join(unhealthy, ", "))
+	}
+	return result, nil
+}
+
+// ServeClusters - lists every monitored cluster with its verdict
+func (c *Controller) ServeClusters(w http.ResponseWriter, r *http.Request) {
+	list, _ := summaries(c.Clusters())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// ServeCluster - serves the most recent report of the cluster named in the path, with the same status codes as /
+func (c *Controller) ServeCluster(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	cluster, ok := c.Cluster(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no cluster named %q is configured", name))
+		return
+	}
+	mode, ok := statusMode(w, r, c.Config)
+	if !ok {
+		return
+	}
+	serveReport(w, cluster, mode)
+}
+
+// requestedCluster - the cluster named by the cluster query parameter, the first cluster when none is named
+func (c *Controller) requestedCluster(w http.ResponseWriter, r *http.Request) (*Cluster, bool) {
+	name := r.URL.Query().Get("cluster")
+	if name == "" {
+		return c.Clusters()[0], true
+	}
+	cluster, ok := c.Cluster(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no cluster named %q is configured", name))
+	}
+	return cluster, ok
+}
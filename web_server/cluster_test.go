@@ -0,0 +1,142 @@
+package webServer_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	webs "github.com/FidelityInternational/etcd-leader-monitor/web_server"
+	"github.com/cloudfoundry-community/gogobosh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multiple clusters", func() {
+	var (
+		controller *webs.Controller
+		etcdServer *httptest.Server
+	)
+
+	BeforeEach(func() {
+		setupMultiple([]MockRoute{
+			{"GET", "/deployments", `[{"name":"cf-12345","releases":[],"stemcells":[]},{"name":"diego-6789","releases":[],"stemcells":[]}]`, ""},
+			{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/1", `{"id":1,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/1/output", `{"vm_cid":"11","ips":["30.30.30.30"],"agent_id":"11","job_name":"etcd_server-d284104a9345228c01e2","index":0}`, ""},
+			{"GET", "/deployments/diego-6789/vms", `{"id":2,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/2", `{"id":2,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/2/output", `{"vm_cid":"12","ips":["31.31.31.31"],"agent_id":"12","job_name":"database-d284104a9345228c01e2","index":0}`, ""},
+		}, "basic")
+
+		boshClient, _ := gogobosh.NewClient(&gogobosh.Config{
+			Username:    "example_user",
+			Password:    "example_password",
+			BOSHAddress: fakeServer.URL,
+		})
+
+		etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.Host, "31.31.31.31") {
+				w.WriteHeader(500)
+				return
+			}
+			w.WriteHeader(200)
+			fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{}}`)
+		}))
+		controller = webs.CreateController(boshClient, &http.Client{Transport: proxyTo(etcdServer)})
+		directedAt(controller, fakeServer.URL)
+		controller.Config.Clusters = []webs.ClusterConfig{
+			{Name: "cf", DeploymentName: "cf-"},
+			{Name: "diego", DeploymentName: "diego-", JobName: "database"},
+		}
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+		teardown()
+	})
+
+	Describe("#CheckLeaders", func() {
+		It("returns the aggregate verdict over every cluster", func() {
+			mockRecorder := request(controller, "/")
+			Ω(mockRecorder.Code).Should(Equal(200))
+			var result webs.Aggregate
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &result)).Should(Succeed())
+			Ω(result.Healthy).Should(BeFalse())
+			Ω(result.Message).Should(Equal("Unhealthy clusters: diego"))
+			Ω(result.Clusters).Should(HaveLen(2))
+			Ω(result.Clusters[0].Name).Should(Equal("cf"))
+			Ω(result.Clusters[0].Deployment).Should(Equal("cf-12345"))
+			Ω(result.Clusters[0].Healthy).Should(BeTrue())
+			Ω(result.Clusters[1].Deployment).Should(Equal("diego-6789"))
+			Ω(result.Clusters[1].Job).Should(Equal("database"))
+			Ω(result.Clusters[1].Message).Should(Equal(health.MessageQuorumLost))
+			Ω(result.Clusters[1].Href).Should(Equal("/clusters/diego"))
+		})
+
+		It("answers 503 in health mode when any cluster is unhealthy", func() {
+			Ω(request(controller, "/?status=health").Code).Should(Equal(503))
+		})
+	})
+
+	Describe("#ServeClusters", func() {
+		It("lists every cluster with its verdict", func() {
+			mockRecorder := request(controller, "/clusters")
+			Ω(mockRecorder.Code).Should(Equal(200))
+			var list []webs.ClusterSummary
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &list)).Should(Succeed())
+			Ω(list).Should(HaveLen(2))
+			Ω(list[0].Name).Should(Equal("cf"))
+			Ω(list[0].Director).Should(Equal("2daf673a-9755-4b4f-aa6d-3632fbed8019"))
+			Ω(list[1].Name).Should(Equal("diego"))
+			Ω(list[1].Healthy).Should(BeFalse())
+		})
+	})
+
+	Describe("#ServeCluster", func() {
+		It("returns the report of a single cluster", func() {
+			mockRecorder := request(controller, "/clusters/cf")
+			Ω(mockRecorder.Code).Should(Equal(200))
+			var report health.Report
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+			Ω(report.Cluster).Should(Equal("cf"))
+			Ω(report.Deployment).Should(Equal("cf-12345"))
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Nodes).Should(HaveLen(1))
+			Ω(report.Nodes[0].IP).Should(Equal("30.30.30.30"))
+		})
+
+		It("answers 503 in health mode when the cluster is unhealthy", func() {
+			Ω(request(controller, "/clusters/diego?status=health").Code).Should(Equal(503))
+		})
+
+		It("returns a 404 for a cluster that is not configured", func() {
+			mockRecorder := request(controller, "/clusters/nope")
+			Ω(mockRecorder.Code).Should(Equal(404))
+			Ω(mockRecorder.Body.String()).Should(ContainSubstring(`no cluster named \"nope\" is configured`))
+		})
+	})
+
+	Describe("#ServeMetrics", func() {
+		It("labels the metrics of each cluster", func() {
+			request(controller, "/")
+			body := request(controller, "/metrics").Body.String()
+			Ω(body).Should(ContainSubstring(`etcd_monitor_cluster_healthy{cluster="cf"} 1`))
+			Ω(body).Should(ContainSubstring(`etcd_monitor_cluster_healthy{cluster="diego"} 0`))
+		})
+	})
+
+	Describe("#ServeHistory", func() {
+		It("returns the timeline of the cluster asked for", func() {
+			request(controller, "/")
+			mockRecorder := request(controller, "/history?cluster=diego")
+			Ω(mockRecorder.Code).Should(Equal(200))
+			var timeline webs.History
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &timeline)).Should(Succeed())
+			Ω(timeline.Cluster).Should(Equal("diego"))
+			Ω(request(controller, "/history?cluster=nope").Code).Should(Equal(404))
+		})
+	})
+})
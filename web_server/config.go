@@ -0,0 +1,785 @@
+package webServer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/discovery"
+	"github.com/FidelityInternational/etcd-leader-monitor/etcd"
+	"github.com/FidelityInternational/etcd-leader-monitor/maintenance"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config - every setting of the monitor. Each setting is named by its env tag, which is also its environment
+// variable, and by the lower case of that name in a config file. Settings tagged redact are hidden on /config.
+type Config struct {
+	BoshURI                  string           `env:"BOSH_URI"`
+	BoshUsername             string           `env:"BOSH_USERNAME"`
+	BoshPassword             string           `env:"BOSH_PASSWORD" redact:"true"`
+	BoshSkipSSLValidation    bool             `env:"BOSH_SKIP_SSL_VALIDATION" envDefault:"true"`
+	Port                     string           `env:"PORT" envDefault:"8080"`
+	Directors                []DirectorConfig `env:"DIRECTORS"`
+	Clusters                 []ClusterConfig  `env:"CLUSTERS"`
+	Discovery                string           `env:"DISCOVERY" envDefault:"bosh"`
+	EtcdEndpoints            []string         `env:"ETCD_ENDPOINTS"`
+	DiscoveryDNSName         string           `env:"DISCOVERY_DNS_NAME"`
+	EtcdPort                 int              `env:"ETCD_PORT" envDefault:"4001"`
+	EtcdCACert               string           `env:"ETCD_CA_CERT"`
+	EtcdClientCert           string           `env:"ETCD_CLIENT_CERT"`
+	EtcdClientKey            string           `env:"ETCD_CLIENT_KEY" redact:"true"`
+	CfDeploymentName         string           `env:"CF_DEPLOYMENT_NAME" envDefault:"cf-"`
+	EtcdJobName              string           `env:"ETCD_JOB_NAME" envDefault:"etcd_server"`
+	SSLEnabled               bool             `env:"SSL_ENABLED" envDefault:"false"`
+	SkipSSLVerification      bool             `env:"SKIP_SSL_VERIFICATION" envDefault:"false"`
+	EtcdProbeTimeout         time.Duration    `env:"ETCD_PROBE_TIMEOUT" envDefault:"3s"`
+	CheckTimeout             time.Duration    `env:"CHECK_TIMEOUT" envDefault:"8s"`
+	PollInterval             time.Duration    `env:"POLL_INTERVAL" envDefault:"30s"`
+	StaleAfter               time.Duration    `env:"STALE_AFTER" envDefault:"2m"`
+	DiscoveryInterval        time.Duration    `env:"DISCOVERY_INTERVAL" envDefault:"5m"`
+	DiscoveryMinInterval     time.Duration    `env:"DISCOVERY_MIN_INTERVAL" envDefault:"1m"`
+	FollowerLatencyThreshold time.Duration    `env:"FOLLOWER_LATENCY_THRESHOLD" envDefault:"500ms"`
+	FollowerFailureThreshold int              `env:"FOLLOWER_FAILURE_THRESHOLD" envDefault:"10"`
+	StatusMode               string           `env:"STATUS_MODE" envDefault:"legacy"`
+	EtcdAPI                  string           `env:"ETCD_API" envDefault:"auto"`
+	RaftIndexLagThreshold    int              `env:"RAFT_INDEX_LAG_THRESHOLD" envDefault:"1000"`
+	FlappingElections        int              `env:"FLAPPING_ELECTIONS" envDefault:"3"`
+	FlappingWindow           time.Duration    `env:"FLAPPING_WINDOW" envDefault:"10m"`
+	ConfirmChecks            int              `env:"CONFIRM_CHECKS" envDefault:"1"`
+	RecoveryChecks           int              `env:"RECOVERY_CHECKS" envDefault:"1"`
+	MaintenanceWindows       []string         `env:"MAINTENANCE_WINDOWS" envSeparator:";"`
+	MaintenanceDuringDeploys bool             `env:"MAINTENANCE_DURING_DEPLOYS" envDefault:"true"`
+	DeployGracePeriod        time.Duration    `env:"DEPLOY_GRACE_PERIOD" envDefault:"5m"`
+	StorePath                string           `env:"STORE_PATH"`
+	StoreRetention           time.Duration    `env:"STORE_RETENTION" envDefault:"168h"`
+	InstanceIndex            string           `env:"CF_INSTANCE_INDEX"`
+	MonitorURL               string           `env:"MONITOR_URL"`
+	WebhookURLs              []string         `env:"WEBHOOK_URLS" redact:"url"`
+	SlackWebhookURLs         []string         `env:"SLACK_WEBHOOK_URLS" redact:"url"`
+	TeamsWebhookURLs         []string         `env:"TEAMS_WEBHOOK_URLS" redact:"url"`
+	PagerDutyRoutingKeys     []string         `env:"PAGERDUTY_ROUTING_KEYS" redact:"true"`
+	PagerDutyEventsURL       string           `env:"PAGERDUTY_EVENTS_URL" envDefault:"https://events.pagerduty.com/v2/enqueue"`
+	SMTPHost                 string           `env:"SMTP_HOST"`
+	SMTPPort                 int              `env:"SMTP_PORT" envDefault:"587"`
+	SMTPStartTLS             bool             `env:"SMTP_STARTTLS" envDefault:"true"`
+	SMTPUsername             string           `env:"SMTP_USERNAME"`
+	SMTPPassword             string           `env:"SMTP_PASSWORD" redact:"true"`
+	SMTPFrom                 string           `env:"SMTP_FROM" envDefault:"etcd-leader-monitor@localhost"`
+	SMTPTo                   []string         `env:"SMTP_TO"`
+	SMTPDigestWindow         time.Duration    `env:"SMTP_DIGEST_WINDOW" envDefault:"0s"`
+	AlertRetries             int              `env:"ALERT_RETRIES" envDefault:"3"`
+	AlertBackoff             time.Duration    `env:"ALERT_BACKOFF" envDefault:"2s"`
+	AlertTimeout             time.Duration    `env:"ALERT_TIMEOUT" envDefault:"10s"`
+	AlertDedupWindow         time.Duration    `env:"ALERT_DEDUP_WINDOW" envDefault:"30m"`
+}
+
+// DefaultClusterName - the name of the single cluster described by the top level settings when no clusters are listed
+const DefaultClusterName = "default"
+
+// DefaultDirectorName - the name of the director described by the top level BOSH settings when no directors are listed
+const DefaultDirectorName = "default"
+
+// clusterName - the names allowed for a cluster or director, which appear in URLs and metric labels
+var clusterName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// DirectorConfig - a BOSH director along with the clusters it deploys. A director that lists no clusters has a single
+// cluster of the same name described by the top level settings.
+type DirectorConfig struct {
+	Name              string          `json:"name" yaml:"name"`
+	URI               string          `json:"uri" yaml:"uri"`
+	Username          string          `json:"username" yaml:"username"`
+	Password          string          `json:"password" yaml:"password" redact:"true"`
+	ClientID          string          `json:"client_id" yaml:"client_id"`
+	ClientSecret      string          `json:"client_secret" yaml:"client_secret" redact:"true"`
+	CACert            string          `json:"ca_cert" yaml:"ca_cert"`
+	SkipSSLValidation *bool           `json:"skip_ssl_validation" yaml:"skip_ssl_validation"`
+	Clusters          []ClusterConfig `json:"clusters" yaml:"clusters"`
+}
+
+// ClusterConfig - a single etcd cluster to monitor, found by matching a BOSH deployment and job, or through static
+// endpoints or DNS. Blank settings fall back to the top level setting of the same name.
+type ClusterConfig struct {
+	Name                string   `json:"name" yaml:"name"`
+	Director            string   `json:"-" yaml:"-"`
+	Discovery           string   `json:"discovery" yaml:"discovery"`
+	DeploymentName      string   `json:"deployment_name" yaml:"deployment_name"`
+	JobName             string   `json:"job_name" yaml:"job_name"`
+	Endpoints           []string `json:"endpoints" yaml:"endpoints"`
+	DNSName             string   `json:"dns_name" yaml:"dns_name"`
+	Port                int      `json:"port" yaml:"port"`
+	SSLEnabled          *bool    `json:"ssl_enabled" yaml:"ssl_enabled"`
+	SkipSSLVerification *bool    `json:"skip_ssl_verification" yaml:"skip_ssl_verification"`
+	CACert              string   `json:"ca_cert" yaml:"ca_cert"`
+	ClientCert          string   `json:"client_cert" yaml:"client_cert"`
+	ClientKey           string   `json:"client_key" yaml:"client_key" redact:"true"`
+	EtcdAPI             string   `json:"etcd_api" yaml:"etcd_api"`
+}
+
+// DirectorDefinitions - the directors to monitor with blank settings filled in from the top level settings, or a
+// single director named default described by the top level BOSH settings when none are listed
+func (c Config) DirectorDefinitions() []DirectorConfig {
+	if len(c.Directors) == 0 {
+		skipSSLValidation := c.BoshSkipSSLValidation
+		return []DirectorConfig{{
+			Name:              DefaultDirectorName,
+			URI:               c.BoshURI,
+			Username:          c.BoshUsername,
+			Password:          c.BoshPassword,
+			SkipSSLValidation: &skipSSLValidation,
+			Clusters:          c.Clusters,
+		}}
+	}
+	var definitions []DirectorConfig
+	for _, director := range c.Directors {
+		if director.SkipSSLValidation == nil {
+			skipSSLValidation := c.BoshSkipSSLValidation
+			director.SkipSSLValidation = &skipSSLValidation
+		}
+		definitions = append(definitions, director)
+	}
+	return definitions
+}
+
+// directorDefinition - the definition of the named director
+func (c Config) directorDefinition(name string) (DirectorConfig, bool) {
+	for _, definition := range c.DirectorDefinitions() {
+		if definition.Name == name {
+			return definition, true
+		}
+	}
+	return DirectorConfig{}, false
+}
+
+// ClusterDefinitions - the clusters to monitor on every director with blank settings filled in from the top level
+// settings. A director listing no clusters has a single cluster described by the top level settings, named after the
+// director or default when no directors are listed.
+func (c Config) ClusterDefinitions() []ClusterConfig {
+	var definitions []ClusterConfig
+	for _, director := range c.DirectorDefinitions() {
+		clusters := director.Clusters
+		if len(clusters) == 0 {
+			name := director.Name
+			if len(c.Directors) == 0 {
+				name = DefaultClusterName
+			}
+			clusters = []ClusterConfig{{Name: name}}
+		}
+		for _, cluster := range clusters {
+			cluster.Director = director.Name
+			definitions = append(definitions, c.withDefaults(cluster))
+		}
+	}
+	return definitions
+}
+
+// withDefaults - fills in the blank settings of a cluster from the top level settings
+func (c Config) withDefaults(cluster ClusterConfig) ClusterConfig {
+	if cluster.Discovery == "" {
+		cluster.Discovery = c.Discovery
+	}
+	if len(cluster.Endpoints) == 0 {
+		cluster.Endpoints = urls(c.EtcdEndpoints)
+	}
+	if cluster.DNSName == "" {
+		cluster.DNSName = c.DiscoveryDNSName
+	}
+	if cluster.Port == 0 {
+		cluster.Port = c.EtcdPort
+	}
+	if cluster.CACert == "" {
+		cluster.CACert = c.EtcdCACert
+	}
+	if cluster.ClientCert == "" && cluster.ClientKey == "" {
+		cluster.ClientCert = c.EtcdClientCert
+		cluster.ClientKey = c.EtcdClientKey
+	}
+	if cluster.DeploymentName == "" {
+		cluster.DeploymentName = c.CfDeploymentName
+	}
+	if cluster.JobName == "" {
+		cluster.JobName = c.EtcdJobName
+	}
+	if cluster.EtcdAPI == "" {
+		cluster.EtcdAPI = c.EtcdAPI
+	}
+	if cluster.SSLEnabled == nil {
+		sslEnabled := c.SSLEnabled
+		cluster.SSLEnabled = &sslEnabled
+	}
+	if cluster.SkipSSLVerification == nil {
+		skipSSLVerification := c.SkipSSLVerification
+		cluster.SkipSSLVerification = &skipSSLVerification
+	}
+	return cluster
+}
+
+// UsesBOSH - whether any cluster is discovered through a BOSH director
+func (c Config) UsesBOSH() bool {
+	for _, definition := range c.ClusterDefinitions() {
+		if definition.Discovery == discovery.ModeBOSH {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterDefinition - the definition of the named cluster
+func (c Config) clusterDefinition(name string) (ClusterConfig, bool) {
+	for _, definition := range c.ClusterDefinitions() {
+		if definition.Name == name {
+			return definition, true
+		}
+	}
+	return ClusterConfig{}, false
+}
+
+// setting - a single field of the config along with its name and tags
+type setting struct {
+	name  string
+	field reflect.Value
+	tag   reflect.StructTag
+}
+
+// settings - every setting of the config, in declaration order
+func settings(config *Config) []setting {
+	value := reflect.ValueOf(config).Elem()
+	var all []setting
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		all = append(all, setting{name: field.Tag.Get("env"), field: value.Field(i), tag: field.Tag})
+	}
+	return all
+}
+
+// set - parses a setting from its string form, lists are split on the setting's separator while lists of
+// structured values, such as clusters, are written as JSON
+func (s setting) set(value string) error {
+	if s.structured() {
+		return s.setStructured([]byte(value))
+	}
+	if s.field.Kind() == reflect.Slice {
+		separator := s.tag.Get("envSeparator")
+		if separator == "" {
+			separator = ","
+		}
+		s.field.Set(reflect.ValueOf(strings.Split(value, separator)))
+		return nil
+	}
+	return s.setOne(value)
+}
+
+func (s setting) setOne(value string) error {
+	switch s.field.Interface().(type) {
+	case string:
+		s.field.SetString(value)
+	case bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", s.name, value)
+		}
+		s.field.SetBool(parsed)
+	case int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number, got %q", s.name, value)
+		}
+		s.field.SetInt(int64(parsed))
+	case time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration such as 30s or 5m, got %q", s.name, value)
+		}
+		s.field.SetInt(int64(parsed))
+	default:
+		return fmt.Errorf("%s has an unsupported type %s", s.name, s.field.Type())
+	}
+	return nil
+}
+
+// structured - whether the setting is a list of structured values rather than of strings
+func (s setting) structured() bool {
+	return s.field.Kind() == reflect.Slice && s.field.Type().Elem().Kind() == reflect.Struct
+}
+
+// setStructured - parses a list of structured values written as YAML or JSON, which is a subset of YAML
+func (s setting) setStructured(contents []byte) error {
+	list := reflect.New(s.field.Type())
+	if err := yaml.Unmarshal(contents, list.Interface()); err != nil {
+		return fmt.Errorf("%s must be a list of settings: %v", s.name, err)
+	}
+	s.field.Set(list.Elem())
+	return nil
+}
+
+// reset - returns the setting to its default, which is blank for settings without one
+func (s setting) reset() {
+	s.field.Set(reflect.Zero(s.field.Type()))
+	if value := s.tag.Get("envDefault"); value != "" {
+		if err := s.set(value); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// DefaultConfig - returns the config with every setting at its default
+func DefaultConfig() Config {
+	var config Config
+	for _, s := range settings(&config) {
+		s.reset()
+	}
+	return config
+}
+
+// LoadConfig - starts from the defaults, applies the config file at path when one is given, then any environment
+// variables that are set, and validates the result. An environment variable that is set but empty returns its setting
+// to the default. Every problem found is reported at once.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	var problems []string
+	if path != "" {
+		problems = append(problems, config.loadFile(path)...)
+	}
+	for _, s := range settings(&config) {
+		value, ok := os.LookupEnv(s.name)
+		if !ok {
+			continue
+		}
+		if value == "" {
+			s.reset()
+			continue
+		}
+		if err := s.set(value); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	problems = append(problems, config.problems()...)
+	if len(problems) > 0 {
+		return config, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return config, nil
+}
+
+// loadFile - applies a YAML or JSON config file, keyed by the lower case setting names
+func (c *Config) loadFile(path string) []string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("could not read config file: %v", err)}
+	}
+	values := map[string]interface{}{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(contents, &values)
+	} else {
+		err = yaml.Unmarshal(contents, &values)
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("could not parse config file %s: %v", path, err)}
+	}
+
+	byName := map[string]setting{}
+	for _, s := range settings(c) {
+		byName[strings.ToLower(s.name)] = s
+	}
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		s, ok := byName[strings.ToLower(key)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s in %s is not a known setting", key, path))
+			continue
+		}
+		if err := s.setValue(values[key]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// setValue - sets a setting from a value decoded from a config file
+func (s setting) setValue(value interface{}) error {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		if s.field.Kind() != reflect.Slice {
+			return fmt.Errorf("%s must be a single value, got a list", s.name)
+		}
+		if s.structured() {
+			contents, err := yaml.Marshal(typed)
+			if err != nil {
+				return fmt.Errorf("%s must be a list of settings: %v", s.name, err)
+			}
+			return s.setStructured(contents)
+		}
+		list := []string{}
+		for _, item := range typed {
+			list = append(list, fmt.Sprint(item))
+		}
+		s.field.Set(reflect.ValueOf(list))
+		return nil
+	case map[interface{}]interface{}, map[string]interface{}:
+		return fmt.Errorf("%s must be a single value or a list, got a map", s.name)
+	default:
+		return s.set(fmt.Sprint(typed))
+	}
+}
+
+// problems - checks the settings make sense together, describing each problem found
+func (c Config) problems() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Directors) == 0 && c.UsesBOSH() {
+		if c.BoshURI == "" {
+			add("BOSH_URI is required")
+		} else if err := checkURL(c.BoshURI); err != nil {
+			add("BOSH_URI %v", err)
+		}
+	}
+	if len(c.Directors) > 0 && len(c.Clusters) > 0 {
+		add("CLUSTERS cannot be combined with DIRECTORS, list the clusters of each director instead")
+	}
+	for name, pattern := range map[string]string{"CF_DEPLOYMENT_NAME": c.CfDeploymentName, "ETCD_JOB_NAME": c.EtcdJobName} {
+		if _, err := regexp.Compile(fmt.Sprintf("^%s*", pattern)); err != nil {
+			add("%s is not a valid regular expression: %v", name, err)
+		}
+	}
+	if !validEtcdAPI(c.EtcdAPI) {
+		add("ETCD_API must be one of %s, %s or %s, got %q", etcd.APIv2, etcd.APIv3, etcd.APIAuto, c.EtcdAPI)
+	}
+	if !validDiscovery(c.Discovery) {
+		add("DISCOVERY must be one of %s, %s, %s, %s or %s, got %q", discovery.ModeBOSH, discovery.ModeStatic, discovery.ModeDNS, discovery.ModeDNSSRV, discovery.ModeMembers, c.Discovery)
+	}
+	if c.EtcdPort < 1 || c.EtcdPort > 65535 {
+		add("ETCD_PORT must be between 1 and 65535, got %d", c.EtcdPort)
+	}
+	for _, problem := range endpointProblems(urls(c.EtcdEndpoints)) {
+		add("ETCD_ENDPOINTS %s", problem)
+	}
+	problems = append(problems, tlsProblems(func(field string) string {
+		return "ETCD_" + strings.ToUpper(field)
+	}, c.EtcdCACert, c.EtcdClientCert, c.EtcdClientKey)...)
+	problems = append(problems, c.directorProblems()...)
+	problems = append(problems, c.clusterProblems()...)
+	problems = append(problems, c.discoveryProblems()...)
+	if !validStatusMode(c.StatusMode) {
+		add("STATUS_MODE must be one of %s or %s, got %q", StatusModeLegacy, StatusModeHealth, c.StatusMode)
+	}
+	for name, duration := range map[string]time.Duration{
+		"ETCD_PROBE_TIMEOUT": c.EtcdProbeTimeout,
+		"CHECK_TIMEOUT":      c.CheckTimeout,
+		"POLL_INTERVAL":      c.PollInterval,
+		"DISCOVERY_INTERVAL": c.DiscoveryInterval,
+	} {
+		if duration <= 0 {
+			add("%s must be longer than 0s, got %s", name, duration)
+		}
+	}
+	for name, count := range map[string]int{"CONFIRM_CHECKS": c.ConfirmChecks, "RECOVERY_CHECKS": c.RecoveryChecks} {
+		if count < 1 {
+			add("%s must be at least 1, got %d", name, count)
+		}
+	}
+	if c.AlertRetries < 0 {
+		add("ALERT_RETRIES must not be negative, got %d", c.AlertRetries)
+	}
+	if _, err := maintenance.ParseAll(c.MaintenanceWindows); err != nil {
+		add("MAINTENANCE_WINDOWS: %v", err)
+	}
+	if c.MonitorURL != "" {
+		if err := checkURL(c.MonitorURL); err != nil {
+			add("MONITOR_URL %v", err)
+		}
+	}
+	for name, list := range map[string][]string{
+		"WEBHOOK_URLS":       c.WebhookURLs,
+		"SLACK_WEBHOOK_URLS": c.SlackWebhookURLs,
+		"TEAMS_WEBHOOK_URLS": c.TeamsWebhookURLs,
+	} {
+		for i, raw := range urls(list) {
+			if err := checkURL(raw); err != nil {
+				add("%s entry %d %v", name, i+1, err)
+			}
+		}
+	}
+	if len(urls(c.PagerDutyRoutingKeys)) > 0 {
+		if err := checkURL(c.PagerDutyEventsURL); err != nil {
+			add("PAGERDUTY_EVENTS_URL %v", err)
+		}
+	}
+	if c.SMTPHost != "" {
+		if len(urls(c.SMTPTo)) == 0 {
+			add("SMTP_TO is required when SMTP_HOST is set")
+		}
+		if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+			add("SMTP_PORT must be between 1 and 65535, got %d", c.SMTPPort)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// directorProblems - checks each director listed has a unique name and can be reached
+func (c Config) directorProblems() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	seen := map[string]bool{}
+	for i, director := range c.Directors {
+		name := director.Name
+		switch {
+		case name == "":
+			add("DIRECTORS entry %d has no name", i+1)
+			name = fmt.Sprintf("entry %d", i+1)
+		case !clusterName.MatchString(name):
+			add("DIRECTORS entry %d name %q may only contain letters, digits, dots, dashes and underscores", i+1, name)
+		case seen[name]:
+			add("DIRECTORS name %q is used more than once", name)
+		}
+		seen[name] = true
+		if director.URI == "" {
+			add("DIRECTORS %s uri is required", name)
+		} else if err := checkURL(director.URI); err != nil {
+			add("DIRECTORS %s uri %v", name, err)
+		}
+		if director.ClientID != "" && director.ClientSecret == "" {
+			add("DIRECTORS %s client_secret is required when client_id is set", name)
+		}
+		if director.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(director.CACert)) {
+			add("DIRECTORS %s ca_cert is not a PEM encoded certificate", name)
+		}
+	}
+	return problems
+}
+
+// clusterProblems - checks each cluster listed, at the top level or by a director, has a name that is unique across
+// every director and valid settings of its own
+func (c Config) clusterProblems() []string {
+	seen := map[string]bool{}
+	problems := checkClusters("CLUSTERS", c.Clusters, seen)
+	for _, director := range c.Directors {
+		if len(director.Clusters) == 0 {
+			if seen[director.Name] {
+				problems = append(problems, fmt.Sprintf("DIRECTORS %s cluster name %q is used more than once", director.Name, director.Name))
+			}
+			seen[director.Name] = true
+			continue
+		}
+		problems = append(problems, checkClusters(fmt.Sprintf("DIRECTORS %s clusters", director.Name), director.Clusters, seen)...)
+	}
+	return problems
+}
+
+// checkClusters - checks a list of clusters, described in problems by setting, against each other and the names seen
+func checkClusters(setting string, clusters []ClusterConfig, seen map[string]bool) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for i, cluster := range clusters {
+		name := cluster.Name
+		switch {
+		case name == "":
+			add("%s entry %d has no name", setting, i+1)
+			name = fmt.Sprintf("entry %d", i+1)
+		case !clusterName.MatchString(name):
+			add("%s entry %d name %q may only contain letters, digits, dots, dashes and underscores", setting, i+1, name)
+		case seen[name]:
+			add("%s name %q is used more than once", setting, name)
+		}
+		seen[name] = true
+		for field, pattern := range map[string]string{"deployment_name": cluster.DeploymentName, "job_name": cluster.JobName} {
+			if _, err := regexp.Compile(fmt.Sprintf("^%s*", pattern)); err != nil {
+				add("%s %s %s is not a valid regular expression: %v", setting, name, field, err)
+			}
+		}
+		if cluster.EtcdAPI != "" && !validEtcdAPI(cluster.EtcdAPI) {
+			add("%s %s etcd_api must be one of %s, %s or %s, got %q", setting, name, etcd.APIv2, etcd.APIv3, etcd.APIAuto, cluster.EtcdAPI)
+		}
+		if cluster.Discovery != "" && !validDiscovery(cluster.Discovery) {
+			add("%s %s discovery must be one of %s, %s, %s, %s or %s, got %q", setting, name, discovery.ModeBOSH, discovery.ModeStatic, discovery.ModeDNS, discovery.ModeDNSSRV, discovery.ModeMembers, cluster.Discovery)
+		}
+		if cluster.Port < 0 || cluster.Port > 65535 {
+			add("%s %s port must be between 1 and 65535, got %d", setting, name, cluster.Port)
+		}
+		for _, problem := range endpointProblems(cluster.Endpoints) {
+			add("%s %s endpoints %s", setting, name, problem)
+		}
+		problems = append(problems, tlsProblems(func(field string) string {
+			return fmt.Sprintf("%s %s %s", setting, name, field)
+		}, cluster.CACert, cluster.ClientCert, cluster.ClientKey)...)
+	}
+	return problems
+}
+
+// discoveryProblems - checks every cluster has what its discovery mode needs, once the top level settings are applied
+func (c Config) discoveryProblems() []string {
+	var problems []string
+	for _, definition := range c.ClusterDefinitions() {
+		switch definition.Discovery {
+		case discovery.ModeStatic, discovery.ModeMembers:
+			if len(definition.Endpoints) == 0 {
+				problems = append(problems, fmt.Sprintf("cluster %s uses %s discovery but lists no endpoints", definition.Name, definition.Discovery))
+			}
+		case discovery.ModeDNS, discovery.ModeDNSSRV:
+			if definition.DNSName == "" {
+				problems = append(problems, fmt.Sprintf("cluster %s uses %s discovery but has no dns_name", definition.Name, definition.Discovery))
+			}
+		}
+	}
+	return problems
+}
+
+func validDiscovery(mode string) bool {
+	return mode == discovery.ModeBOSH || mode == discovery.ModeStatic || mode == discovery.ModeDNS || mode == discovery.ModeDNSSRV ||
+		mode == discovery.ModeMembers
+}
+
+// endpointProblems - describes each endpoint that cannot be parsed
+func endpointProblems(endpoints []string) []string {
+	var problems []string
+	for i, raw := range endpoints {
+		if _, err := discovery.ParseEndpoint(raw, "http", etcd.DefaultPort); err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d %v", i+1, err))
+		}
+	}
+	return problems
+}
+
+// tlsProblems - describes a CA cert, client cert or client key that could not be used, naming each setting through name
+func tlsProblems(name func(field string) string, caCert string, clientCert string, clientKey string) []string {
+	var problems []string
+	if caCert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(caCert)) {
+		problems = append(problems, fmt.Sprintf("%s is not a PEM encoded certificate", name("ca_cert")))
+	}
+	if (clientCert == "") != (clientKey == "") {
+		problems = append(problems, fmt.Sprintf("%s and %s must be set together", name("client_cert"), name("client_key")))
+	} else if clientCert != "" {
+		if _, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s and %s are not a valid pair: %v", name("client_cert"), name("client_key"), err))
+		}
+	}
+	return problems
+}
+
+func validEtcdAPI(api string) bool {
+	return api == etcd.APIv2 || api == etcd.APIv3 || api == etcd.APIAuto
+}
+
+// checkURL - checks a URL has a scheme and host
+func checkURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %v", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute URL such as https://example.com, got %q", redactURL(raw))
+	}
+	return nil
+}
+
+// redactURL - keeps only the scheme and host of a URL, whose path or query may hold a secret
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "<redacted>"
+	}
+	return fmt.Sprintf("%s://%s/<redacted>", parsed.Scheme, parsed.Host)
+}
+
+// Redacted - the effective settings keyed by their config file names, with secrets hidden
+func (c Config) Redacted() map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for _, s := range settings(&c) {
+		var value interface{}
+		switch typed := s.field.Interface().(type) {
+		case time.Duration:
+			value = typed.String()
+		default:
+			value = typed
+		}
+		switch s.tag.Get("redact") {
+		case "true":
+			value = redact(s.field, func(string) string { return "<redacted>" })
+		case "url":
+			value = redact(s.field, redactURL)
+		}
+		if s.structured() {
+			value = redactStructured(s.field)
+		}
+		redacted[strings.ToLower(s.name)] = value
+	}
+	return redacted
+}
+
+// redact - hides a string or each entry of a list, leaving blanks visible so that a missing secret is obvious
+func redact(field reflect.Value, hide func(string) string) interface{} {
+	hideSet := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return hide(value)
+	}
+	if list, ok := field.Interface().([]string); ok {
+		hidden := []string{}
+		for _, value := range list {
+			hidden = append(hidden, hideSet(value))
+		}
+		return hidden
+	}
+	return hideSet(field.String())
+}
+
+// redactStructured - copies a list of structured settings, hiding the fields tagged redact that are set, including
+// those of nested lists
+func redactStructured(field reflect.Value) interface{} {
+	return redactList(field).Interface()
+}
+
+func redactList(list reflect.Value) reflect.Value {
+	if list.IsNil() {
+		return list
+	}
+	hidden := reflect.MakeSlice(list.Type(), list.Len(), list.Len())
+	reflect.Copy(hidden, list)
+	for i := 0; i < hidden.Len(); i++ {
+		item := hidden.Index(i)
+		for j := 0; j < item.NumField(); j++ {
+			field := item.Field(j)
+			switch {
+			case item.Type().Field(j).Tag.Get("redact") == "true" && field.String() != "":
+				field.SetString("<redacted>")
+			case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+				field.Set(redactList(field))
+			}
+		}
+	}
+	return hidden
+}
+
+// ServeConfig - shows the effective config with secrets redacted
+func (c *Controller) ServeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c.Config.Redacted())
+}
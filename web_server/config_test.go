@@ -0,0 +1,331 @@
+package webServer_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	webs "github.com/FidelityInternational/etcd-leader-monitor/web_server"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var dir string
+
+	write := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		Ω(ioutil.WriteFile(path, []byte(contents), 0600)).Should(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config")
+		Ω(err).Should(BeNil())
+		os.Setenv("BOSH_URI", "https://10.0.0.6:25555")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		for _, name := range []string{"BOSH_URI", "POLL_INTERVAL", "ETCD_JOB_NAME", "CONFIRM_CHECKS", "CLUSTERS", "CF_DEPLOYMENT_NAME", "MAINTENANCE_WINDOWS", "STORE_PATH"} {
+			os.Unsetenv(name)
+		}
+	})
+
+	Describe("#LoadConfig", func() {
+		It("uses the defaults when there is no config file", func() {
+			config, err := webs.LoadConfig("")
+			Ω(err).Should(BeNil())
+			Ω(config.BoshURI).Should(Equal("https://10.0.0.6:25555"))
+			Ω(config.CfDeploymentName).Should(Equal("cf-"))
+			Ω(config.PollInterval).Should(Equal(30 * time.Second))
+			Ω(config.MaintenanceDuringDeploys).Should(BeTrue())
+		})
+
+		It("reads a YAML file and lets environment variables override it", func() {
+			os.Setenv("POLL_INTERVAL", "45s")
+			config, err := webs.LoadConfig(write("config.yml", `---
+cf_deployment_name: cf-prod
+poll_interval: 10s
+confirm_checks: 3
+ssl_enabled: true
+maintenance_windows:
+- 0 2 * * 0 2h
+- 0 3 * * 3 1h
+`))
+			Ω(err).Should(BeNil())
+			Ω(config.CfDeploymentName).Should(Equal("cf-prod"))
+			Ω(config.PollInterval).Should(Equal(45 * time.Second))
+			Ω(config.ConfirmChecks).Should(Equal(3))
+			Ω(config.SSLEnabled).Should(BeTrue())
+			Ω(config.MaintenanceWindows).Should(Equal([]string{"0 2 * * 0 2h", "0 3 * * 3 1h"}))
+			Ω(config.StaleAfter).Should(Equal(2 * time.Minute))
+		})
+
+		It("lets an empty environment variable return a setting from the file to its default", func() {
+			os.Setenv("CF_DEPLOYMENT_NAME", "")
+			os.Setenv("POLL_INTERVAL", "")
+			os.Setenv("MAINTENANCE_WINDOWS", "")
+			os.Setenv("STORE_PATH", "")
+			config, err := webs.LoadConfig(write("config.yml", `---
+cf_deployment_name: cf-prod
+poll_interval: 10s
+maintenance_windows:
+- 0 2 * * 0 2h
+store_path: /var/vcap/data/history
+`))
+			Ω(err).Should(BeNil())
+			Ω(config.CfDeploymentName).Should(Equal("cf-"))
+			Ω(config.PollInterval).Should(Equal(30 * time.Second))
+			Ω(config.MaintenanceWindows).Should(BeEmpty())
+			Ω(config.StorePath).Should(BeEmpty())
+		})
+
+		It("reads a JSON file", func() {
+			config, err := webs.LoadConfig(write("config.json", `{"BOSH_URI": "https://10.0.0.7:25555", "confirm_checks": 2, "webhook_urls": ["https://hooks.example.com/a"]}`))
+			Ω(err).Should(BeNil())
+			Ω(config.BoshURI).Should(Equal("https://10.0.0.6:25555"))
+			Ω(config.ConfirmChecks).Should(Equal(2))
+			Ω(config.WebhookURLs).Should(Equal([]string{"https://hooks.example.com/a"}))
+		})
+
+		It("reports every problem at once", func() {
+			os.Unsetenv("BOSH_URI")
+			os.Setenv("ETCD_JOB_NAME", "etcd_server(")
+			os.Setenv("CONFIRM_CHECKS", "three")
+			_, err := webs.LoadConfig(write("config.yml", `---
+poll_interval: soon
+check_timeout: 0s
+etcd_api: v4
+status_mode: strict
+maintenance_windows: 0 2 * * 0
+pager_duty: true
+`))
+			Ω(err).Should(MatchError(`invalid configuration:
+  - pager_duty in ` + filepath.Join(dir, "config.yml") + ` is not a known setting
+  - POLL_INTERVAL must be a duration such as 30s or 5m, got "soon"
+  - CONFIRM_CHECKS must be a whole number, got "three"
+  - BOSH_URI is required
+  - CHECK_TIMEOUT must be longer than 0s, got 0s
+  - ETCD_API must be one of v2, v3 or auto, got "v4"
+  - ETCD_JOB_NAME is not a valid regular expression: error parsing regexp: missing argument to repetition operator: ` + "`*`" + `
+  - MAINTENANCE_WINDOWS: maintenance window "0 2 * * 0" must be a five field cron schedule and a duration
+  - STATUS_MODE must be one of legacy or health, got "strict"`))
+		})
+
+		It("reads the clusters from a file, filling in blank settings from the top level ones", func() {
+			config, err := webs.LoadConfig(write("config.yml", `---
+ssl_enabled: true
+clusters:
+- name: cf
+- name: diego
+  deployment_name: diego-
+  job_name: database
+  ssl_enabled: false
+  etcd_api: v3
+`))
+			Ω(err).Should(BeNil())
+			definitions := config.ClusterDefinitions()
+			Ω(definitions).Should(HaveLen(2))
+			Ω(definitions[0].Name).Should(Equal("cf"))
+			Ω(definitions[0].DeploymentName).Should(Equal("cf-"))
+			Ω(definitions[0].JobName).Should(Equal("etcd_server"))
+			Ω(*definitions[0].SSLEnabled).Should(BeTrue())
+			Ω(definitions[0].EtcdAPI).Should(Equal("auto"))
+			Ω(definitions[1].DeploymentName).Should(Equal("diego-"))
+			Ω(*definitions[1].SSLEnabled).Should(BeFalse())
+			Ω(definitions[1].EtcdAPI).Should(Equal("v3"))
+		})
+
+		It("reads the clusters from JSON in the environment", func() {
+			os.Setenv("CLUSTERS", `[{"name":"cf"},{"name":"iso-seg","deployment_name":"iso-seg-"}]`)
+			config, err := webs.LoadConfig("")
+			Ω(err).Should(BeNil())
+			Ω(config.Clusters).Should(HaveLen(2))
+			Ω(config.Clusters[1].DeploymentName).Should(Equal("iso-seg-"))
+		})
+
+		It("describes a single default cluster when none are listed", func() {
+			config, err := webs.LoadConfig("")
+			Ω(err).Should(BeNil())
+			definitions := config.ClusterDefinitions()
+			Ω(definitions).Should(HaveLen(1))
+			Ω(definitions[0].Name).Should(Equal(webs.DefaultClusterName))
+			Ω(definitions[0].DeploymentName).Should(Equal("cf-"))
+		})
+
+		It("reports clusters that are not uniquely and validly named or configured", func() {
+			_, err := webs.LoadConfig(write("config.yml", `---
+clusters:
+- deployment_name: cf-
+- name: cf
+- name: cf
+  job_name: etcd(
+- name: iso seg
+  etcd_api: v4
+`))
+			Ω(err).Should(MatchError(`invalid configuration:
+  - CLUSTERS cf job_name is not a valid regular expression: error parsing regexp: missing argument to repetition operator: ` + "`*`" + `
+  - CLUSTERS entry 1 has no name
+  - CLUSTERS entry 4 name "iso seg" may only contain letters, digits, dots, dashes and underscores
+  - CLUSTERS iso seg etcd_api must be one of v2, v3 or auto, got "v4"
+  - CLUSTERS name "cf" is used more than once`))
+		})
+
+		It("reads the directors and their clusters, without needing BOSH_URI", func() {
+			os.Unsetenv("BOSH_URI")
+			config, err := webs.LoadConfig(write("config.yml", `---
+directors:
+- name: london
+  uri: https://10.0.0.6:25555
+  client_id: etcd-monitor
+  client_secret: s3cret
+  skip_ssl_validation: false
+  clusters:
+  - name: cf-london
+  - name: diego-london
+    deployment_name: diego-
+- name: dublin
+  uri: https://10.1.0.6:25555
+  username: admin
+  password: hunter2
+`))
+			Ω(err).Should(BeNil())
+			directors := config.DirectorDefinitions()
+			Ω(directors).Should(HaveLen(2))
+			Ω(directors[0].ClientID).Should(Equal("etcd-monitor"))
+			Ω(*directors[0].SkipSSLValidation).Should(BeFalse())
+			Ω(*directors[1].SkipSSLValidation).Should(BeTrue())
+
+			clusters := config.ClusterDefinitions()
+			Ω(clusters).Should(HaveLen(3))
+			Ω(clusters[1].Name).Should(Equal("diego-london"))
+			Ω(clusters[1].Director).Should(Equal("london"))
+			Ω(clusters[1].DeploymentName).Should(Equal("diego-"))
+			Ω(clusters[2].Name).Should(Equal("dublin"))
+			Ω(clusters[2].Director).Should(Equal("dublin"))
+			Ω(clusters[2].DeploymentName).Should(Equal("cf-"))
+		})
+
+		It("describes the default director from the top level BOSH settings when none are listed", func() {
+			config, err := webs.LoadConfig("")
+			Ω(err).Should(BeNil())
+			directors := config.DirectorDefinitions()
+			Ω(directors).Should(HaveLen(1))
+			Ω(directors[0].Name).Should(Equal(webs.DefaultDirectorName))
+			Ω(directors[0].URI).Should(Equal("https://10.0.0.6:25555"))
+			Ω(config.ClusterDefinitions()[0].Director).Should(Equal(webs.DefaultDirectorName))
+		})
+
+		It("reports directors that are not uniquely named or cannot be reached", func() {
+			_, err := webs.LoadConfig(write("config.yml", `---
+clusters:
+- name: cf
+directors:
+- name: london
+  client_id: etcd-monitor
+  ca_cert: not a cert
+- name: london
+  uri: https://10.1.0.6:25555
+  clusters:
+  - name: dublin
+- name: dublin
+  uri: https://10.2.0.6:25555
+`))
+			Ω(err).Should(MatchError(`invalid configuration:
+  - CLUSTERS cannot be combined with DIRECTORS, list the clusters of each director instead
+  - DIRECTORS dublin cluster name "dublin" is used more than once
+  - DIRECTORS london ca_cert is not a PEM encoded certificate
+  - DIRECTORS london client_secret is required when client_id is set
+  - DIRECTORS london uri is required
+  - DIRECTORS name "london" is used more than once`))
+		})
+
+		It("reads clusters found without BOSH, without needing BOSH_URI", func() {
+			os.Unsetenv("BOSH_URI")
+			config, err := webs.LoadConfig(write("config.yml", `---
+discovery: static
+etcd_endpoints:
+- https://10.0.0.5:2379
+- 10.0.0.6
+etcd_port: 2379
+clusters:
+- name: cf
+- name: k8s
+  discovery: dns-srv
+  dns_name: k8s.example.com
+`))
+			Ω(err).Should(BeNil())
+			Ω(config.UsesBOSH()).Should(BeFalse())
+			clusters := config.ClusterDefinitions()
+			Ω(clusters[0].Discovery).Should(Equal("static"))
+			Ω(clusters[0].Endpoints).Should(Equal([]string{"https://10.0.0.5:2379", "10.0.0.6"}))
+			Ω(clusters[0].Port).Should(Equal(2379))
+			Ω(clusters[1].Discovery).Should(Equal("dns-srv"))
+			Ω(clusters[1].DNSName).Should(Equal("k8s.example.com"))
+		})
+
+		It("reports clusters that cannot be discovered", func() {
+			_, err := webs.LoadConfig(write("config.yml", `---
+discovery: dns
+etcd_port: 70000
+etcd_client_cert: not a cert
+clusters:
+- name: cf
+- name: static
+  discovery: static
+  endpoints:
+  - ftp://10.0.0.5
+- name: consul
+  discovery: consul
+`))
+			Ω(err).Should(MatchError(`invalid configuration:
+  - CLUSTERS consul discovery must be one of bosh, static, dns, dns-srv or members, got "consul"
+  - CLUSTERS static endpoints entry 1 endpoint "ftp://10.0.0.5" must use http or https
+  - ETCD_CLIENT_CERT and ETCD_CLIENT_KEY must be set together
+  - ETCD_PORT must be between 1 and 65535, got 70000
+  - cluster cf uses dns discovery but has no dns_name`))
+		})
+
+		It("reports a file that cannot be parsed", func() {
+			path := write("config.yml", "poll_interval: [10s\n")
+			_, err := webs.LoadConfig(path)
+			Ω(err.Error()).Should(ContainSubstring("could not parse config file " + path))
+		})
+	})
+
+	Describe("#ServeConfig", func() {
+		It("shows the effective config with secrets redacted", func() {
+			controller := webs.CreateController(nil, &http.Client{})
+			controller.Config.BoshPassword = "hunter2"
+			controller.Config.SlackWebhookURLs = []string{"https://hooks.slack.com/services/T000/B000/XXXX"}
+			controller.Config.PagerDutyRoutingKeys = []string{"routing-key"}
+			controller.Config.Directors = []webs.DirectorConfig{{Name: "london", Username: "admin", Password: "hunter2", ClientSecret: "s3cret"}}
+
+			mockRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://example.com/config", nil)
+			Router(controller).ServeHTTP(mockRecorder, req)
+			Ω(mockRecorder.Code).Should(Equal(200))
+
+			var config map[string]interface{}
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &config)).Should(Succeed())
+			Ω(config["bosh_password"]).Should(Equal("<redacted>"))
+			Ω(config["smtp_password"]).Should(Equal(""))
+			Ω(config["slack_webhook_urls"]).Should(Equal([]interface{}{"https://hooks.slack.com/<redacted>"}))
+			Ω(config["pagerduty_routing_keys"]).Should(Equal([]interface{}{"<redacted>"}))
+			Ω(config["poll_interval"]).Should(Equal("30s"))
+			Ω(config["confirm_checks"]).Should(BeNumerically("==", 1))
+			director := config["directors"].([]interface{})[0].(map[string]interface{})
+			Ω(director["username"]).Should(Equal("admin"))
+			Ω(director["password"]).Should(Equal("<redacted>"))
+			Ω(director["client_secret"]).Should(Equal("<redacted>"))
+			Ω(mockRecorder.Body.String()).ShouldNot(ContainSubstring("hunter2"))
+			Ω(mockRecorder.Body.String()).ShouldNot(ContainSubstring("s3cret"))
+		})
+	})
+})
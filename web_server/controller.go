@@ -1,28 +1,45 @@
 package webServer
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
 	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+	"github.com/FidelityInternational/etcd-leader-monitor/discovery"
 	"github.com/FidelityInternational/etcd-leader-monitor/etcd"
-	"github.com/caarlos0/env"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/metrics"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
 	"github.com/cloudfoundry-community/gogobosh"
 	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusModeLegacy - / answers 200 whatever the verdict and an empty 500 when the monitor fails
+	StatusModeLegacy = "legacy"
+	// StatusModeHealth - / answers 200 when healthy, 503 when unhealthy and 502 with a json error when the monitor fails
+	StatusModeHealth = "health"
 )
 
 // Controller struct
 type Controller struct {
 	BoshClient     *gogobosh.Client
 	EtcdHTTPClient *http.Client
-}
-
-// Config struct
-type Config struct {
-	CfDeploymentName    string `env:"CF_DEPLOYMENT_NAME" envDefault:"cf-"`
-	EtcdJobName         string `env:"ETCD_JOB_NAME" envDefault:"etcd_server"`
-	SSLEnabled          bool   `env:"SSL_ENABLED" envDefault:"false"`
-	SkipSSLVerification bool   `env:"SKIP_SSL_VERIFICATION" envDefault:"false"`
+	Resolver       discovery.Resolver
+	Config         Config
+	Metrics        *metrics.Monitor
+	Store          store.Store
+	Alerts         *alert.Dispatcher
+	clustersMutex  sync.Mutex
+	clusters       map[string]*Cluster
+	directorsMutex sync.Mutex
+	directors      map[string]*Director
 }
 
 // CreateController - returns a populated controller object
@@ -30,136 +47,392 @@ func CreateController(boshClient *gogobosh.Client, etcdHTTPClient *http.Client)
 	return &Controller{
 		BoshClient:     boshClient,
 		EtcdHTTPClient: etcdHTTPClient,
+		Resolver:       discovery.SystemResolver{},
+		Config:         DefaultConfig(),
+		Metrics:        metrics.NewMonitor(),
+		clusters:       make(map[string]*Cluster),
+		directors:      make(map[string]*Director),
 	}
 }
 
-// CheckLeaders - checks if leaders are in a healthy state
+// CheckLeaders - serves the most recent report of the cluster, checking the cluster first if none is cached. When
+// several clusters are configured the aggregate verdict over all of them is served instead.
 func (c *Controller) CheckLeaders(w http.ResponseWriter, r *http.Request) {
-	var etcdProtocol = `http`
+	mode, ok := statusMode(w, r, c.Config)
+	if !ok {
+		return
+	}
 
-	fmt.Println("Checking Leaders...")
-	fmt.Println("Fetching Bosh deployment...")
-	deployments, err := c.BoshClient.GetDeployments()
+	clusters := c.Clusters()
+	if len(clusters) == 1 {
+		serveReport(w, clusters[0], mode)
+		return
+	}
+	result, err := aggregate(clusters)
 	if err != nil {
-		errorPrint(err, w)
+		writeCheckError(w, mode, err)
 		return
 	}
-	deployconfig := Config{}
-	env.Parse(&deployconfig)
-	deployment := bosh.FindDeployment(deployments, fmt.Sprintf("^%s*", deployconfig.CfDeploymentName))
-	fmt.Println("Found deployment: ", deployment)
-	if deployconfig.SSLEnabled {
-		etcdProtocol = "https"
-		err = c.LoadCerts(deployconfig, deployment)
-		if err != nil {
-			errorPrint(err, w)
-			return
+	status := http.StatusOK
+	if mode == StatusModeHealth && !result.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// statusMode - the status code mode requested by the status query parameter or configured, writing an error when invalid
+func statusMode(w http.ResponseWriter, r *http.Request, deployconfig Config) (string, bool) {
+	mode := deployconfig.StatusMode
+	if requested := r.URL.Query().Get("status"); requested != "" {
+		if !validStatusMode(requested) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("status must be one of %s or %s, got %q", StatusModeLegacy, StatusModeHealth, requested))
+			return "", false
 		}
+		mode = requested
 	}
-	fmt.Println("Fetching Etcd IPs from BOSH...")
-	boshVMs, err := c.BoshClient.GetDeploymentVMs(deployment)
-	if err != nil {
-		errorPrint(err, w)
-		return
+	if !validStatusMode(mode) {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("STATUS_MODE must be one of %s or %s, got %q", StatusModeLegacy, StatusModeHealth, mode))
+		return "", false
 	}
-	etcdVMs := bosh.FindVMs(boshVMs, fmt.Sprintf("^%s*", deployconfig.EtcdJobName))
-	fmt.Println("Found Etcd VMs")
-	httpResponseMessage, err := c.etcdProcess(etcdVMs, etcdProtocol, w)
+	return mode, true
+}
+
+func validStatusMode(mode string) bool {
+	return mode == StatusModeLegacy || mode == StatusModeHealth
+}
+
+// serveReport - serves the most recent report of a cluster, answering 503 for an unhealthy cluster in health mode
+func serveReport(w http.ResponseWriter, cluster *Cluster, mode string) {
+	report, err := cluster.current()
 	if err != nil {
-		errorPrint(err, w)
+		writeCheckError(w, mode, err)
 		return
 	}
+	status := http.StatusOK
+	if mode == StatusModeHealth && !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, httpResponseMessage)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeCheckError - reports a check that could not be completed, as a json 502 in health mode and an empty 500 otherwise
+func writeCheckError(w http.ResponseWriter, mode string, err error) {
+	if mode == StatusModeHealth {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	errorPrint(err, w)
+}
+
+// Check - probes each of the cluster's etcd endpoints last discovered
+func (cl *Cluster) Check(ctx context.Context) (health.Report, error) {
+	definition, deployconfig, err := cl.definition()
+	if err != nil {
+		return health.Report{}, err
+	}
+
+	fmt.Printf("Checking Leaders of cluster %s...\n", cl.Name)
+	if !validEtcdAPI(definition.EtcdAPI) {
+		return health.Report{}, fmt.Errorf("ETCD_API must be one of %s, %s or %s, got %q", etcd.APIv2, etcd.APIv3, etcd.APIAuto, definition.EtcdAPI)
+	}
+	topology, err := cl.currentTopology(deployconfig.DiscoveryMinInterval)
+	if err != nil && topology.discoveredAt.IsZero() {
+		return health.Report{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, deployconfig.CheckTimeout)
+	defer cancel()
+	report := cl.etcdProcess(ctx, topology, definition.EtcdAPI, deployconfig)
+	report.Cluster = cl.Name
+	report.DirectorName = topology.directorName
+	report.Director = topology.director
+	report.Deployment = topology.deployment
+	report.Job = topology.job
+	report.DiscoveredAt = topology.discoveredAt
+	if err != nil {
+		report.LastError = err.Error()
+	}
+	for _, node := range report.Nodes {
+		if !node.Reachable {
+			cl.InvalidateTopology()
+			break
+		}
+	}
+	return report, nil
 }
 
 // LoadCerts - downloads certs from BOSH and configures the EtcdHTTPClient appropriately
 func (c *Controller) LoadCerts(deployconfig Config, deployment string) error {
-	fmt.Println("Fetching Etcd Certs...")
-	boshDeployment, err := c.BoshClient.GetDeployment(deployment)
+	tr, err := etcdTransport(bosh.Gogobosh{Client: c.BoshClient}, deployment, deployconfig.EtcdJobName, deployconfig.SkipSSLVerification)
 	if err != nil {
 		return err
 	}
-	etcdCerts, err := bosh.GetEtcdCerts(boshDeployment.Manifest, fmt.Sprintf("^%s*", deployconfig.EtcdJobName))
+	c.EtcdHTTPClient.Transport = tr
+	return nil
+}
+
+// etcdTransport - downloads the certs of an etcd job from the BOSH deployment's manifest and returns a transport
+// presenting them
+func etcdTransport(boshClient bosh.Director, deployment string, jobName string, skipSSLVerification bool) (*http.Transport, error) {
+	fmt.Println("Fetching Etcd Certs...")
+	boshDeployment, err := boshClient.GetDeployment(deployment)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	etcdCerts, err := bosh.GetEtcdCerts(boshDeployment.Manifest, fmt.Sprintf("^%s*", jobName))
+	if err != nil {
+		return nil, err
 	}
 	if etcdCerts.ClientKey == "" {
-		return fmt.Errorf("Etcd Client Key was blank")
+		return nil, fmt.Errorf("Etcd Client Key was blank")
 	}
 	if etcdCerts.ClientCert == "" {
-		return fmt.Errorf("Etcd Client Cert was blank")
+		return nil, fmt.Errorf("Etcd Client Cert was blank")
+	}
+	if !skipSSLVerification && etcdCerts.CaCert == "" {
+		return nil, fmt.Errorf("Etcd CA Cert was blank")
 	}
-	caCert := x509.NewCertPool()
-	if !deployconfig.SkipSSLVerification {
-		if etcdCerts.CaCert == "" {
-			return fmt.Errorf("Etcd CA Cert was blank")
+	if skipSSLVerification {
+		etcdCerts.CaCert = ""
+	}
+	return tlsTransport(etcdCerts.CaCert, etcdCerts.ClientCert, etcdCerts.ClientKey, skipSSLVerification)
+}
+
+// tlsTransport - returns a transport trusting the CA cert, or the system's CAs when it is blank, and presenting the
+// client cert and key when they are set
+func tlsTransport(caCertPEM string, clientCertPEM string, clientKeyPEM string, skipSSLVerification bool) (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: skipSSLVerification}
+	if caCertPEM != "" || skipSSLVerification {
+		caCert := x509.NewCertPool()
+		if caCertPEM != "" && !caCert.AppendCertsFromPEM([]byte(caCertPEM)) {
+			return nil, fmt.Errorf("Could not add CA Cert, CA Cert was likely invalid")
 		}
-		if !caCert.AppendCertsFromPEM([]byte(etcdCerts.CaCert)) {
-			return fmt.Errorf("Could not add CA Cert, CA Cert was likely invalid")
+		tlsConfig.RootCAs = caCert
+	}
+	if clientCertPEM != "" || clientKeyPEM != "" {
+		clientCert, err := tls.X509KeyPair([]byte(clientCertPEM), []byte(clientKeyPEM))
+		if err != nil {
+			return nil, err
 		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	tr := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	return tr, nil
+}
+
+func (cl *Cluster) etcdProcess(ctx context.Context, topology topology, api string, deployconfig Config) health.Report {
+	var wg sync.WaitGroup
+
+	httpClient := topology.httpClient
+	if httpClient == nil {
+		httpClient = cl.controller.EtcdHTTPClient
 	}
-	clientCert, err := tls.X509KeyPair([]byte(etcdCerts.ClientCert), []byte(etcdCerts.ClientKey))
+	nodes := make([]health.Node, len(topology.endpoints))
+	for i, endpoint := range topology.endpoints {
+		nodes[i] = health.Node{
+			IP:       endpoint.Host,
+			Endpoint: endpoint.URL(),
+			JobName:  endpoint.JobName,
+			Index:    endpoint.Index,
+			VMCID:    endpoint.VMCID,
+		}
+		wg.Add(1)
+		go func(node *health.Node, endpoint discovery.Endpoint) {
+			defer wg.Done()
+			probe(ctx, node, httpClient, endpoint, api, deployconfig.EtcdProbeTimeout)
+		}(&nodes[i], endpoint)
+	}
+	wg.Wait()
+	countV3Followers(nodes)
+
+	if previous, ok := cl.LastReport(); ok {
+		countFailuresSince(nodes, previous.Nodes)
+	}
+	report := health.Evaluate(nodes, health.Thresholds{
+		FollowerLatency:  deployconfig.FollowerLatencyThreshold,
+		FollowerFailures: uint64(deployconfig.FollowerFailureThreshold),
+		RaftIndexLag:     uint64(deployconfig.RaftIndexLagThreshold),
+	})
+	for _, problem := range report.Problems {
+		fmt.Printf("Etcd problem detected in cluster %s: %s %s %s\n", cl.Name, problem.Message, problem.IP, problem.Detail)
+	}
+	return report
+}
+
+// probe - fetches the state of a single node through the configured API, bounded by the probe timeout
+func probe(ctx context.Context, node *health.Node, httpClient *http.Client, endpoint discovery.Endpoint, api string, probeTimeout time.Duration) {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	etcdClient := etcd.NewClient(&etcd.Config{
+		EtcdIP:       endpoint.Host,
+		EtcdPort:     endpoint.Port,
+		HTTPClient:   httpClient,
+		EtcdProtocol: endpoint.Protocol,
+	})
+	start := time.Now()
+	if api == etcd.APIAuto {
+		detected, err := etcdClient.DetectAPI(probeCtx)
+		if err != nil {
+			fmt.Printf("Could not detect etcd API of %s, falling back to %s: %v\n", node.IP, etcd.APIv2, err)
+			detected = etcd.APIv2
+		}
+		api = detected
+	}
+	node.API = api
+	var err error
+	if api == etcd.APIv3 {
+		err = probeV3(probeCtx, etcdClient, node)
+	} else {
+		err = probeV2(probeCtx, etcdClient, node)
+	}
+	node.LatencyMS = time.Since(start).Seconds() * 1000
+	if err != nil {
+		fmt.Printf("Could not probe etcd %s: %v\n", node.IP, err)
+		node.Error = err.Error()
+		node.ErrorReason = etcd.ErrorReason(err)
+		return
+	}
+	node.Reachable = true
+}
+
+// probeV2 - fills in the node from the v2 leader stats, self stats, members and raft headers
+func probeV2(ctx context.Context, etcdClient *etcd.Client, node *health.Node) error {
+	leaderStats, err := etcdClient.GetLeaderStats(ctx)
 	if err != nil {
 		return err
 	}
-	tlsConfig := &tls.Config{
-		RootCAs:            caCert,
-		Certificates:       []tls.Certificate{clientCert},
-		InsecureSkipVerify: deployconfig.SkipSSLVerification,
+	selfStats, err := etcdClient.GetSelfStats(ctx)
+	if err != nil {
+		return err
 	}
-	tr := &http.Transport{
-		TLSClientConfig: tlsConfig,
+	members, err := etcdClient.GetMembers(ctx)
+	if err != nil {
+		return err
 	}
-	c.EtcdHTTPClient.Transport = tr
+	raftStatus, err := etcdClient.GetRaftStatus(ctx)
+	if err != nil {
+		return err
+	}
+	node.ID = selfStats.ID
+	node.Name = selfStats.Name
+	node.State = selfStats.State
+	node.LeaderID = selfStats.LeaderInfo.Leader
+	node.Leader = leaderStats.IsLeader()
+	node.Followers = len(leaderStats.Followers)
+	node.FollowerStats = followerStats(leaderStats)
+	node.Members = memberList(members)
+	node.RaftTerm = raftStatus.Term
+	node.RaftIndex = raftStatus.Index
 	return nil
 }
 
-func (c *Controller) etcdProcess(etcdVMs []gogobosh.VM, etcdProtocol string, w http.ResponseWriter) (string, error) {
-	var (
-		leaderInfo          map[bool]int
-		leaderList          map[string]map[bool]int
-		leaderCount         int
-		httpResponseMessage string
-	)
-
-	leaderList = make(map[string]map[bool]int)
-	for _, etcdVM := range etcdVMs {
-		etcdConfig := &etcd.Config{
-			EtcdIP:       etcdVM.IPs[0],
-			HTTPClient:   c.EtcdHTTPClient,
-			EtcdProtocol: etcdProtocol,
+// probeV3 - fills in the node from the v3 maintenance status and member list
+func probeV3(ctx context.Context, etcdClient *etcd.Client, node *health.Node) error {
+	status, err := etcdClient.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	members, err := etcdClient.GetMemberList(ctx)
+	if err != nil {
+		return err
+	}
+	node.ID = etcd.MemberID(status.Header.MemberID)
+	node.LeaderID = etcd.MemberID(status.Leader)
+	node.Leader = status.IsLeader()
+	node.State = "StateFollower"
+	if node.Leader {
+		node.State = "StateLeader"
+	}
+	node.RaftTerm = status.RaftTerm
+	node.RaftIndex = status.RaftIndex
+	node.RaftApplied = status.RaftAppliedIndex
+	node.DBSizeBytes = status.DBSize
+	node.Errors = status.Errors
+	node.Members = memberList(members)
+	for _, member := range node.Members {
+		if member.ID == node.ID {
+			node.Name = member.Name
 		}
-		etcdClient := etcd.NewClient(etcdConfig)
-		leader, followers, err := etcdClient.GetLeaderStats()
-		if err != nil {
-			return "", err
+	}
+	return nil
+}
+
+// countV3Followers - the v3 status has no follower list, so a v3 leader's followers are the other nodes that agree on it
+func countV3Followers(nodes []health.Node) {
+	for i := range nodes {
+		if nodes[i].API != etcd.APIv3 || !nodes[i].Leader {
+			continue
 		}
-		leaderInfo = make(map[bool]int)
-		leaderInfo[leader] = followers
-		leaderList[etcdVM.IPs[0]] = leaderInfo
-	}
-	for _, leaderItem := range leaderList {
-		for leader, followers := range leaderItem {
-			if leader == true {
-				leaderCount++
-				if followers != (len(etcdVMs) - 1) {
-					httpResponseMessage = `{"healthy": false, "message": "Incorrect number of followers"}`
-				}
+		for j, node := range nodes {
+			if j != i && node.Reachable && node.LeaderID == nodes[i].ID {
+				nodes[i].Followers++
 			}
 		}
 	}
-	if leaderCount > 1 {
-		fmt.Println("More than one etcd leader detected, number of leaders: ", leaderCount)
-		httpResponseMessage = `{"healthy": false, "message": "Too many leaders"}`
-	} else if leaderCount == 0 {
-		fmt.Println("Not enough etcd leaders detected, number of leaders: ", leaderCount)
-		httpResponseMessage = `{"healthy": false, "message": "Not enough leaders"}`
-	} else if httpResponseMessage == "" {
-		httpResponseMessage = `{"healthy": true, "message": "Everything is healthy"}`
+}
+
+// memberList - converts the members a node reported, keeping nil when the node listed none
+func memberList(members []etcd.Member) []health.Member {
+	var list []health.Member
+	for _, member := range members {
+		list = append(list, health.Member{
+			ID:         member.ID,
+			Name:       member.Name,
+			PeerURLs:   member.PeerURLs,
+			ClientURLs: member.ClientURLs,
+		})
+	}
+	return list
+}
+
+// followerStats - converts the leader's view of its followers, ordered by follower ID
+func followerStats(leaderStats etcd.LeaderStats) []health.Follower {
+	var ids []string
+	for id := range leaderStats.Followers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var followers []health.Follower
+	for _, id := range ids {
+		stats := leaderStats.Followers[id]
+		followers = append(followers, health.Follower{
+			ID:               id,
+			LatencyCurrentMS: stats.Latency.Current,
+			LatencyAverageMS: stats.Latency.Average,
+			LatencyStdDevMS:  stats.Latency.StandardDeviation,
+			LatencyMinimumMS: stats.Latency.Minimum,
+			LatencyMaximumMS: stats.Latency.Maximum,
+			SuccessCount:     stats.Counts.Success,
+			FailCount:        stats.Counts.Fail,
+		})
+	}
+	return followers
+}
+
+// countFailuresSince - works out how many times each follower failed since the previous check of the same leader
+func countFailuresSince(nodes []health.Node, previous []health.Node) {
+	previousFailures := make(map[string]uint64)
+	for _, node := range previous {
+		for _, follower := range node.FollowerStats {
+			previousFailures[node.IP+"/"+follower.ID] = follower.FailCount
+		}
+	}
+	for i := range nodes {
+		for j := range nodes[i].FollowerStats {
+			follower := &nodes[i].FollowerStats[j]
+			before, ok := previousFailures[nodes[i].IP+"/"+follower.ID]
+			if ok && follower.FailCount >= before {
+				follower.FailCountSinceCheck = follower.FailCount - before
+			}
+		}
 	}
-	return httpResponseMessage, nil
 }
 
 func errorPrint(err error, w http.ResponseWriter) {
@@ -168,3 +441,11 @@ func errorPrint(err error, w http.ResponseWriter) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// writeError - logs the error and returns it to the client as json with the given status
+func writeError(w http.ResponseWriter, status int, err error) {
+	fmt.Printf("An error occurred: %v\n", err.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
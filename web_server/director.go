@@ -0,0 +1,76 @@
+package webServer
+
+import (
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+	"reflect"
+	"sync"
+)
+
+// Director - a BOSH director deploying monitored clusters, with the client used to reach it and the UUID it last
+// reported. Each director is reached separately so that one that is down or slow only affects its own clusters.
+type Director struct {
+	Name       string
+	controller *Controller
+	mutex      sync.Mutex
+	client     bosh.Director
+	definition DirectorConfig
+	uuid       string
+}
+
+// director - returns the director with the given name, creating it the first time it is needed
+func (c *Controller) director(name string) *Director {
+	c.directorsMutex.Lock()
+	defer c.directorsMutex.Unlock()
+
+	director, ok := c.directors[name]
+	if !ok {
+		director = &Director{Name: name, controller: c}
+		c.directors[name] = director
+	}
+	return director
+}
+
+// Client - the client of the director, built the first time it is needed and again whenever the director's settings
+// change. Without DIRECTORS the default director is described by the top level BOSH settings, so that its tasks are
+// given up on after the same timeout as those of listed directors.
+func (d *Director) Client() (bosh.Director, error) {
+	definition, ok := d.controller.Config.directorDefinition(d.Name)
+	if !ok {
+		return nil, fmt.Errorf("director %s is no longer configured", d.Name)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.client == nil || !reflect.DeepEqual(definition, d.definition) {
+		client, err := bosh.NewClient(bosh.ClientConfig{
+			URI:               definition.URI,
+			Username:          definition.Username,
+			Password:          definition.Password,
+			ClientID:          definition.ClientID,
+			ClientSecret:      definition.ClientSecret,
+			CACert:            definition.CACert,
+			SkipSSLValidation: *definition.SkipSSLValidation,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create client for director %s: %v", d.Name, err)
+		}
+		d.client = client
+		d.definition = definition
+	}
+	return d.client, nil
+}
+
+// UUID - identifies the director, falling back to the UUID it last reported as it is only used to label results
+func (d *Director) UUID(client bosh.Director) string {
+	info, err := client.GetInfo()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err == nil && info.UUID != "" {
+		d.uuid = info.UUID
+		return d.uuid
+	}
+	fmt.Printf("Could not fetch the UUID of BOSH director %s: %v\n", d.Name, err)
+	return d.uuid
+}
@@ -0,0 +1,99 @@
+package webServer_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	webs "github.com/FidelityInternational/etcd-leader-monitor/web_server"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multiple directors", func() {
+	var (
+		controller *webs.Controller
+		etcdServer *httptest.Server
+		downServer *httptest.Server
+	)
+
+	BeforeEach(func() {
+		setupMultiple([]MockRoute{
+			{"GET", "/deployments", `[{"name":"cf-12345","releases":[],"stemcells":[]}]`, ""},
+			{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/1", `{"id":1,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/1/output", `{"vm_cid":"11","ips":["30.30.30.30"],"agent_id":"11","job_name":"etcd_server-d284104a9345228c01e2","index":0}`, ""},
+			{"GET", "/tasks", `[]`, ""},
+		}, "basic")
+		downServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(503)
+		}))
+
+		etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(200)
+			fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{}}`)
+		}))
+		controller = webs.CreateController(nil, &http.Client{Transport: proxyTo(etcdServer)})
+		controller.Config.Directors = []webs.DirectorConfig{
+			{Name: "london", URI: fakeServer.URL, Username: "example_user", Password: "example_password", Clusters: []webs.ClusterConfig{{Name: "cf-london"}}},
+			{Name: "dublin", URI: downServer.URL, Username: "example_user", Password: "example_password"},
+		}
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+		downServer.Close()
+		teardown()
+	})
+
+	It("checks the clusters of every director, isolating a director that cannot be reached", func() {
+		mockRecorder := request(controller, "/")
+		Ω(mockRecorder.Code).Should(Equal(200))
+		var result webs.Aggregate
+		Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &result)).Should(Succeed())
+		Ω(result.Message).Should(Equal("Unhealthy clusters: dublin"))
+		Ω(result.Clusters).Should(HaveLen(2))
+
+		Ω(result.Clusters[0].Name).Should(Equal("cf-london"))
+		Ω(result.Clusters[0].DirectorName).Should(Equal("london"))
+		Ω(result.Clusters[0].Director).Should(Equal("2daf673a-9755-4b4f-aa6d-3632fbed8019"))
+		Ω(result.Clusters[0].Healthy).Should(BeTrue())
+
+		Ω(result.Clusters[1].Name).Should(Equal("dublin"))
+		Ω(result.Clusters[1].DirectorName).Should(Equal("dublin"))
+		Ω(result.Clusters[1].Message).Should(Equal(health.MessageCheckFailed))
+		Ω(result.Clusters[1].LastError).Should(Equal("BOSH answered 503 Service Unavailable to GET /info"))
+	})
+
+	It("labels the report of a cluster with its director's name and UUID", func() {
+		var report health.Report
+		Ω(json.Unmarshal(request(controller, "/clusters/cf-london").Body.Bytes(), &report)).Should(Succeed())
+		Ω(report.DirectorName).Should(Equal("london"))
+		Ω(report.Director).Should(Equal("2daf673a-9755-4b4f-aa6d-3632fbed8019"))
+		Ω(report.Deployment).Should(Equal("cf-12345"))
+
+		body := request(controller, "/metrics").Body.String()
+		Ω(body).Should(ContainSubstring(`etcd_monitor_cluster_info{cluster="cf-london",director="london",director_uuid="2daf673a-9755-4b4f-aa6d-3632fbed8019",deployment="cf-12345",job="etcd_server"} 1`))
+	})
+
+	Context("when no directors are listed and the task listing the VMs fails", func() {
+		BeforeEach(func() {
+			teardown()
+			setupMultiple([]MockRoute{
+				{"GET", "/deployments", `[{"name":"cf-12345","releases":[],"stemcells":[]}]`, ""},
+				{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+				{"GET", "/tasks/1", `{"id":1,"state":"error","description":"retrieve vm-stats","timestamp":1460639781,"result":"director is overloaded","user":"example_user"}`, ""},
+				{"GET", "/tasks", `[]`, ""},
+			}, "basic")
+			controller.Config.Directors = nil
+			directedAt(controller, fakeServer.URL)
+		})
+
+		It("gives up on the task of the default director like on that of a listed one", func() {
+			_, err := controller.Clusters()[0].Refresh()
+			Ω(err).Should(MatchError("BOSH task 1 finished in state error: director is overloaded"))
+		})
+	})
+})
@@ -0,0 +1,197 @@
+package webServer_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	webs "github.com/FidelityInternational/etcd-leader-monitor/web_server"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupHost(host string) ([]string, error) {
+	addresses, ok := f[host]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+	return addresses, nil
+}
+
+func (f fakeResolver) LookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	return "", nil, fmt.Errorf("lookup _%s._%s.%s: no such host", service, proto, name)
+}
+
+// stuckResolver - a resolver that does not answer for one name until released
+type stuckResolver struct {
+	fakeResolver
+	stuck   string
+	release chan struct{}
+}
+
+func (s stuckResolver) LookupHost(host string) ([]string, error) {
+	if host == s.stuck {
+		<-s.release
+	}
+	return s.fakeResolver.LookupHost(host)
+}
+
+var _ = Describe("Discovery without BOSH", func() {
+	var (
+		controller *webs.Controller
+		etcdServer *httptest.Server
+		mutex      sync.Mutex
+		probed     []string
+		ips        []string
+	)
+
+	BeforeEach(func() {
+		probed = nil
+		etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, _ := net.SplitHostPort(r.Host)
+			mutex.Lock()
+			probed = append(probed, r.Host)
+			mutex.Unlock()
+			var members []string
+			memberID := 0
+			for i, ip := range ips {
+				members = append(members, fmt.Sprintf(`{"ID":"%d","name":"etcd-%d","peerURLs":["http://%[3]s:2380"],"clientURLs":["http://%[3]s:2379"]}`, i+1, i, ip))
+				if ip == host {
+					memberID = i + 1
+				}
+			}
+			switch r.URL.Path {
+			case "/v3/maintenance/status":
+				fmt.Fprintf(w, `{"header":{"member_id":"%d","raft_term":"4"},"leader":"1","raftIndex":"31","raftTerm":"4"}`, memberID)
+			case "/v3/cluster/member/list":
+				fmt.Fprintf(w, `{"members":[%s]}`, strings.Join(members, ","))
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+		controller = webs.CreateController(nil, &http.Client{Transport: proxyTo(etcdServer)})
+		controller.Resolver = fakeResolver{"etcd.example.com": {"10.0.1.6", "10.0.1.5"}}
+		controller.Config.EtcdAPI = "v3"
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+	})
+
+	probedHosts := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		hosts := map[string]bool{}
+		for _, host := range probed {
+			hosts[host] = true
+		}
+		var unique []string
+		for host := range hosts {
+			unique = append(unique, host)
+		}
+		sort.Strings(unique)
+		return unique
+	}
+
+	Context("when the endpoints are listed", func() {
+		BeforeEach(func() {
+			controller.Config.Discovery = "static"
+			controller.Config.EtcdEndpoints = []string{"http://10.0.0.5:2379", "10.0.0.6"}
+			ips = []string{"10.0.0.5", "10.0.0.6"}
+		})
+
+		It("probes each endpoint on its own port", func() {
+			var report health.Report
+			Ω(json.Unmarshal(request(controller, "/").Body.Bytes(), &report)).Should(Succeed())
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Director).Should(BeEmpty())
+			Ω(report.Deployment).Should(BeEmpty())
+			Ω(report.Nodes).Should(HaveLen(2))
+			Ω(report.Nodes[0].IP).Should(Equal("10.0.0.5"))
+			Ω(report.Nodes[0].Endpoint).Should(Equal("http://10.0.0.5:2379"))
+			Ω(report.Nodes[1].Endpoint).Should(Equal("http://10.0.0.6:4001"))
+			Ω(probedHosts()).Should(Equal([]string{"10.0.0.5:2379", "10.0.0.6:4001"}))
+		})
+
+		It("does not label the cluster with a director", func() {
+			var summaries []webs.ClusterSummary
+			Ω(json.Unmarshal(request(controller, "/clusters").Body.Bytes(), &summaries)).Should(Succeed())
+			Ω(summaries).Should(HaveLen(1))
+			Ω(summaries[0].DirectorName).Should(BeEmpty())
+			Ω(summaries[0].Healthy).Should(BeTrue())
+		})
+	})
+
+	Context("when the endpoints are found through DNS", func() {
+		BeforeEach(func() {
+			controller.Config.Clusters = []webs.ClusterConfig{
+				{Name: "resolved", Discovery: "dns", DNSName: "etcd.example.com", Port: 2379},
+				{Name: "missing", Discovery: "dns", DNSName: "missing.example.com"},
+			}
+			ips = []string{"10.0.1.5", "10.0.1.6"}
+		})
+
+		It("probes every address the name resolves to, failing only the cluster whose name does not resolve", func() {
+			var result webs.Aggregate
+			Ω(json.Unmarshal(request(controller, "/").Body.Bytes(), &result)).Should(Succeed())
+			Ω(result.Message).Should(Equal("Unhealthy clusters: missing"))
+			Ω(result.Clusters[0].Name).Should(Equal("resolved"))
+			Ω(result.Clusters[0].Healthy).Should(BeTrue())
+			Ω(result.Clusters[1].LastError).Should(Equal("lookup missing.example.com: no such host"))
+			Ω(probedHosts()).Should(Equal([]string{"10.0.1.5:2379", "10.0.1.6:2379"}))
+		})
+
+		It("keeps polling the other clusters while the discovery of one is stuck", func() {
+			release := make(chan struct{})
+			defer close(release)
+			controller.Resolver = stuckResolver{
+				fakeResolver: fakeResolver{"etcd.example.com": {"10.0.1.6", "10.0.1.5"}},
+				stuck:        "missing.example.com",
+				release:      release,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go controller.Poll(ctx, 10*time.Millisecond)
+
+			resolved := controller.Clusters()[0]
+			var first health.Report
+			Eventually(func() bool {
+				var ok bool
+				first, ok = resolved.LastReport()
+				return ok
+			}).Should(BeTrue())
+			Eventually(func() time.Time {
+				report, _ := resolved.LastReport()
+				return report.CheckedAt
+			}).Should(BeTemporally(">", first.CheckedAt))
+		})
+	})
+
+	Context("when the members are listed by a seed endpoint", func() {
+		BeforeEach(func() {
+			controller.Config.Discovery = "members"
+			controller.Config.EtcdEndpoints = []string{"10.0.0.5:2379"}
+			ips = []string{"10.0.0.5", "10.0.0.6", "10.0.0.7"}
+		})
+
+		It("probes every member etcd knows of, not only the seed", func() {
+			var report health.Report
+			Ω(json.Unmarshal(request(controller, "/").Body.Bytes(), &report)).Should(Succeed())
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Nodes).Should(HaveLen(3))
+			Ω(report.Nodes[2].Endpoint).Should(Equal("http://10.0.0.7:2379"))
+			Ω(report.Nodes[2].Name).Should(Equal("etcd-2"))
+			Ω(probedHosts()).Should(Equal([]string{"10.0.0.5:2379", "10.0.0.6:2379", "10.0.0.7:2379"}))
+		})
+	})
+})
@@ -0,0 +1,197 @@
+package webServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
+	"net/http"
+	"time"
+)
+
+// historyLimit - the number of leader periods and changes kept in memory
+const historyLimit = 1000
+
+// History - the leadership timeline of a cluster served on /history
+type History struct {
+	Cluster           string           `json:"cluster"`
+	Periods           []history.Period `json:"periods"`
+	Changes           []history.Change `json:"changes"`
+	ElectionsInWindow int              `json:"elections_in_window"`
+	WindowSeconds     float64          `json:"window_seconds"`
+}
+
+// ServeHistory - returns which member was leader when and every leader change observed in the cluster given by the
+// cluster query parameter, the first cluster by default
+func (c *Controller) ServeHistory(w http.ResponseWriter, r *http.Request) {
+	deployconfig := c.Config
+
+	cluster, ok := c.requestedCluster(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(History{
+		Cluster:           cluster.Name,
+		Periods:           cluster.History.Periods(),
+		Changes:           cluster.History.Changes(),
+		ElectionsInWindow: cluster.History.ElectionsSince(time.Now().Add(-deployconfig.FlappingWindow)),
+		WindowSeconds:     deployconfig.FlappingWindow.Seconds(),
+	})
+}
+
+// ServeCheckHistory - returns the stored check results since the time given by the since query parameter, the last
+// hour by default, of every cluster or only of the cluster given by the cluster query parameter
+func (c *Controller) ServeCheckHistory(w http.ResponseWriter, r *http.Request) {
+	if c.Store == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no state store is configured, set STORE_PATH"))
+		return
+	}
+	since := time.Now().Add(-time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("since must be an RFC3339 time: %v", err))
+			return
+		}
+		since = parsed
+	}
+	checks, err := c.Store.Checks(since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if name := r.URL.Query().Get("cluster"); name != "" {
+		var filtered []store.Check
+		for _, check := range checks {
+			if check.Cluster == name {
+				filtered = append(filtered, check)
+			}
+		}
+		checks = filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(checks)
+}
+
+// UseStore - persists checks and leader changes to the store, restoring the leadership timeline of each cluster from
+// it. Changes stored before clusters were named belong to the first cluster.
+func (c *Controller) UseStore(s store.Store, retention time.Duration) error {
+	since := time.Time{}
+	if retention > 0 {
+		since = time.Now().Add(-retention)
+	}
+	changes, err := s.Changes(since)
+	if err != nil {
+		return err
+	}
+	for i, cluster := range c.Clusters() {
+		var own []history.Change
+		for _, change := range changes {
+			if change.Cluster == cluster.Name || (change.Cluster == "" && i == 0) {
+				own = append(own, change)
+			}
+		}
+		cluster.History.Load(own)
+	}
+	c.Store = s
+	return nil
+}
+
+// saveCheck - stores a completed check, logging rather than failing the check when the store is unavailable
+func (cl *Cluster) saveCheck(report health.Report, deployconfig Config) {
+	if cl.controller.Store == nil {
+		return
+	}
+	if err := cl.controller.Store.SaveCheck(store.CheckFromReport(report, deployconfig.InstanceIndex)); err != nil {
+		fmt.Printf("Could not store check result: %v\n", err)
+	}
+}
+
+// recordLeadership - adds the leader seen by a completed check to the cluster's timeline and flags the report when
+// the leader is flapping. A check that reached no node says nothing about the leader, so it is left out rather than
+// recorded as a loss of the leader that would count its return as an election.
+func (cl *Cluster) recordLeadership(report health.Report, deployconfig Config) health.Report {
+	c := cl.controller
+	observation := observedLeader(report)
+	var (
+		change  history.Change
+		changed bool
+	)
+	if anyReachable(report) {
+		change, changed = cl.History.Record(observation)
+	}
+	if changed {
+		change.Cluster = cl.Name
+		fmt.Printf("Etcd leader of cluster %s changed from %s to %s\n", cl.Name, describeLeader(change.FromLeaderID, change.FromIP), describeLeader(change.ToLeaderID, change.ToIP))
+		if c.Store != nil {
+			if err := c.Store.SaveChange(change); err != nil {
+				fmt.Printf("Could not store leader change: %v\n", err)
+			}
+		}
+	}
+	elections := cl.History.ElectionsSince(observation.At.Add(-deployconfig.FlappingWindow))
+	c.Metrics.RecordElections(cl.Name, changed && change.IsElection(), elections)
+	if deployconfig.FlappingElections > 0 && elections > deployconfig.FlappingElections {
+		report = health.WithProblem(report, health.Problem{
+			Message: health.MessageLeaderFlapping,
+			Detail:  fmt.Sprintf("%d elections in the last %s, more than %d", elections, deployconfig.FlappingWindow, deployconfig.FlappingElections),
+		})
+	}
+	return report
+}
+
+// anyReachable - whether the check reached at least one node
+func anyReachable(report health.Report) bool {
+	for _, node := range report.Nodes {
+		if node.Reachable {
+			return true
+		}
+	}
+	return false
+}
+
+// observedLeader - the leader the nodes agree on, falling back to the single node claiming leadership
+// when no node reported which leader it follows
+func observedLeader(report health.Report) history.Observation {
+	observation := history.Observation{At: report.CheckedAt}
+	switch len(report.LeaderGroups) {
+	case 0:
+		var leaders []health.Node
+		for _, node := range report.Nodes {
+			if node.Reachable && node.Leader {
+				leaders = append(leaders, node)
+			}
+		}
+		if len(leaders) == 1 {
+			observation.LeaderID = leaders[0].ID
+			if observation.LeaderID == "" {
+				observation.LeaderID = leaders[0].IP
+			}
+			observation.LeaderIP = leaders[0].IP
+			observation.Term = leaders[0].RaftTerm
+		}
+	case 1:
+		observation.LeaderID = report.LeaderGroups[0].LeaderID
+		for _, node := range report.Nodes {
+			if node.Reachable && observation.LeaderID != "" && node.ID == observation.LeaderID {
+				observation.LeaderIP = node.IP
+				observation.Term = node.RaftTerm
+			}
+		}
+	}
+	return observation
+}
+
+func describeLeader(leaderID string, ip string) string {
+	if leaderID == "" {
+		return "no leader"
+	}
+	if ip == "" {
+		return leaderID
+	}
+	return fmt.Sprintf("%s (%s)", leaderID, ip)
+}
@@ -0,0 +1,67 @@
+package webServer
+
+import (
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/maintenance"
+	"time"
+)
+
+// confirm - replaces the report's raw verdict with the confirmed one, honouring any maintenance under way
+func (cl *Cluster) confirm(report health.Report, deployconfig Config) health.Report {
+	confirmation := health.Confirmation{
+		UnhealthyChecks: deployconfig.ConfirmChecks,
+		HealthyChecks:   deployconfig.RecoveryChecks,
+	}
+	confirmation.Maintenance, confirmation.Updating = cl.updating(report.CheckedAt, report.Deployment, deployconfig)
+	if !confirmation.Updating {
+		confirmation.Maintenance = scheduledMaintenance(report.CheckedAt, deployconfig)
+	}
+	return cl.Confirmer.Confirm(report, confirmation)
+}
+
+// scheduledMaintenance - describes the maintenance window active at now, if any
+func scheduledMaintenance(now time.Time, deployconfig Config) string {
+	windows, err := maintenance.ParseAll(deployconfig.MaintenanceWindows)
+	if err != nil {
+		fmt.Printf("Ignoring maintenance windows: %v\n", err)
+		return ""
+	}
+	if window, ok := maintenance.Active(windows, now); ok {
+		return fmt.Sprintf("scheduled window %s", window.Spec)
+	}
+	return ""
+}
+
+// updating - whether BOSH is updating the deployment, either with a processing or queued task or having finished
+// one within the grace period, and a description of the update
+func (cl *Cluster) updating(now time.Time, deployment string, deployconfig Config) (string, bool) {
+	if !deployconfig.MaintenanceDuringDeploys || deployment == "" {
+		return "", false
+	}
+	tasks, err := cl.runningTasks(deployment)
+	if err != nil {
+		fmt.Printf("Could not fetch running BOSH tasks: %v\n", err)
+	} else if len(tasks) > 0 {
+		cl.updatedAt = now
+		return fmt.Sprintf("BOSH task %d (%s) is %s", tasks[0].ID, tasks[0].Description, tasks[0].State), true
+	}
+	if since := now.Sub(cl.updatedAt); !cl.updatedAt.IsZero() && since < deployconfig.DeployGracePeriod {
+		return fmt.Sprintf("BOSH finished updating %s ago, within the %s grace period", since-since%time.Second, deployconfig.DeployGracePeriod), true
+	}
+	return "", false
+}
+
+// runningTasks - the processing and queued tasks acting on the deployment, fetched from the cluster's director
+func (cl *Cluster) runningTasks(deployment string) ([]bosh.Task, error) {
+	definition, _, err := cl.definition()
+	if err != nil {
+		return nil, err
+	}
+	boshClient, err := cl.controller.director(definition.Director).Client()
+	if err != nil {
+		return nil, err
+	}
+	return boshClient.GetRunningTasks(deployment)
+}
@@ -0,0 +1,95 @@
+package webServer
+
+import (
+	"context"
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"net/http"
+	"time"
+)
+
+// Poll - refreshes the cached report of every cluster every interval until the context is cancelled. Each cluster is
+// refreshed on its own, and one still being checked when the interval comes round is left to finish.
+func (c *Controller) Poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var polled rounds
+	for {
+		polled.start(c.Clusters(), func(cluster *Cluster) {
+			cluster.Refresh()
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh - checks the cluster and caches the result, keeping the previous report if the check fails
+func (cl *Cluster) Refresh() (health.Report, error) {
+	cl.refreshMutex.Lock()
+	defer cl.refreshMutex.Unlock()
+
+	c := cl.controller
+	report, err := cl.Check(context.Background())
+	if err != nil {
+		fmt.Printf("Could not refresh state of cluster %s: %v\n", cl.Name, err)
+		c.Metrics.RecordCheckError(cl.Name)
+		cl.reportMutex.Lock()
+		if cl.lastReport != nil {
+			cl.lastReport.LastError = err.Error()
+		}
+		cl.reportMutex.Unlock()
+		return health.Report{}, err
+	}
+	deployconfig := c.Config
+	report.CheckedAt = time.Now().UTC()
+	report = cl.recordLeadership(report, deployconfig)
+	report = cl.confirm(report, deployconfig)
+	cl.saveCheck(report, deployconfig)
+	c.Metrics.RecordReport(report)
+	if c.Alerts != nil && report.Maintenance == "" {
+		c.Alerts.Observe(report)
+	}
+
+	cl.reportMutex.Lock()
+	cl.lastReport = &report
+	cl.reportMutex.Unlock()
+	return report, nil
+}
+
+// LastReport - returns the cluster's cached report, if a check has completed
+func (cl *Cluster) LastReport() (health.Report, bool) {
+	cl.reportMutex.RLock()
+	defer cl.reportMutex.RUnlock()
+
+	if cl.lastReport == nil {
+		return health.Report{}, false
+	}
+	return *cl.lastReport, true
+}
+
+// ServeMetrics - exports the cluster state in the Prometheus text format
+func (c *Controller) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	c.Metrics.ServeHTTP(w, r)
+}
+
+// withAge - annotates a cached report with its age, flagging it as stale and unhealthy once too old
+func withAge(report health.Report, now time.Time, staleAfter time.Duration) health.Report {
+	age := now.Sub(report.CheckedAt)
+	report.AgeSeconds = age.Seconds()
+	if staleAfter > 0 && age > staleAfter {
+		report.Stale = true
+		if report.Healthy {
+			report.Healthy = false
+			report.Message = health.MessageStale
+		}
+		report.Problems = append(append([]health.Problem{}, report.Problems...), health.Problem{
+			Message: health.MessageStale,
+			Detail:  fmt.Sprintf("last successful check was %s ago", age-age%time.Second),
+		})
+	}
+	return report
+}
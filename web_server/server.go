@@ -25,6 +25,13 @@ func (s *Server) Start() *mux.Router {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/", s.Controller.CheckLeaders).Methods("GET")
+	router.HandleFunc("/clusters", s.Controller.ServeClusters).Methods("GET")
+	router.HandleFunc("/clusters/{name}", s.Controller.ServeCluster).Methods("GET")
+	router.HandleFunc("/discover", s.Controller.Rediscover).Methods("POST")
+	router.HandleFunc("/metrics", s.Controller.ServeMetrics).Methods("GET")
+	router.HandleFunc("/history", s.Controller.ServeHistory).Methods("GET")
+	router.HandleFunc("/history/checks", s.Controller.ServeCheckHistory).Methods("GET")
+	router.HandleFunc("/config", s.Controller.ServeConfig).Methods("GET")
 
 	return router
 }
@@ -0,0 +1,254 @@
+package webServer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/bosh"
+	"github.com/FidelityInternational/etcd-leader-monitor/discovery"
+	"net/http"
+	"time"
+)
+
+// topology - the etcd endpoints last discovered and how to reach them, with a client presenting the cluster's certs
+// when it uses SSL. Clusters discovered through BOSH also record their director, deployment and job.
+type topology struct {
+	directorName string
+	director     string
+	deployment   string
+	job          string
+	endpoints    []discovery.Endpoint
+	httpClient   *http.Client
+	discoveredAt time.Time
+	invalid      bool
+}
+
+// PollDiscovery - rediscovers the etcd endpoints of every cluster every interval until the context is cancelled. Like
+// Poll, a cluster whose director is slow to answer only delays its own rediscovery.
+func (c *Controller) PollDiscovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var discovered rounds
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			discovered.start(c.Clusters(), func(cluster *Cluster) {
+				if err := cluster.Discover(); err != nil {
+					fmt.Printf("Could not discover etcd endpoints of cluster %s: %v\n", cluster.Name, err)
+				}
+			})
+		}
+	}
+}
+
+// Discover - finds the cluster's etcd endpoints through its discovery mode and caches them for subsequent probes
+func (cl *Cluster) Discover() error {
+	cl.discoverMutex.Lock()
+	defer cl.discoverMutex.Unlock()
+
+	definition, deployconfig, err := cl.definition()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	cl.topologyMutex.Lock()
+	cl.attemptedAt = start
+	cl.topologyMutex.Unlock()
+	err = cl.discover(definition, deployconfig)
+	cl.controller.Metrics.RecordDiscovery(cl.Name, definition.Discovery, time.Since(start), err)
+	return err
+}
+
+// discover - finds the cluster's etcd endpoints through the discoverer of its mode and caches them
+func (cl *Cluster) discover(definition ClusterConfig, deployconfig Config) error {
+	var (
+		discovered *topology
+		discoverer discovery.Discoverer
+		err        error
+	)
+	if definition.Discovery == discovery.ModeBOSH {
+		discovered, discoverer, err = cl.boshDiscoverer(definition)
+	} else {
+		discovered, discoverer, err = cl.endpointDiscoverer(definition, deployconfig.EtcdProbeTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Discovering etcd endpoints of cluster %s through %s...\n", cl.Name, definition.Discovery)
+	discovered.endpoints, err = discoverer.Discover()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found %d etcd endpoints\n", len(discovered.endpoints))
+	discovered.discoveredAt = time.Now().UTC()
+
+	cl.topologyMutex.Lock()
+	cl.topology = discovered
+	cl.rediscoverErr = nil
+	cl.topologyMutex.Unlock()
+	return nil
+}
+
+// boshDiscoverer - finds the first deployment on the cluster's director matching its deployment name, and the etcd
+// certs in the deployment's manifest when the cluster uses SSL, to discover the VMs of its etcd job. The cluster is
+// labelled with the director, deployment and job.
+func (cl *Cluster) boshDiscoverer(definition ClusterConfig) (*topology, discovery.Discoverer, error) {
+	var etcdProtocol = `http`
+
+	c := cl.controller
+	httpClient := c.EtcdHTTPClient
+
+	director := c.director(definition.Director)
+	boshClient, err := director.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	directorUUID := director.UUID(boshClient)
+	fmt.Printf("Fetching Bosh deployment from director %s...\n", director.Name)
+	deployments, err := boshClient.GetDeployments()
+	if err != nil {
+		return nil, nil, err
+	}
+	deployment := bosh.FindDeployment(deployments, fmt.Sprintf("^%s*", definition.DeploymentName))
+	fmt.Println("Found deployment: ", deployment)
+	if *definition.SSLEnabled {
+		etcdProtocol = "https"
+		tr, err := etcdTransport(boshClient, deployment, definition.JobName, *definition.SkipSSLVerification)
+		if err != nil {
+			return nil, nil, err
+		}
+		httpClient = &http.Client{Transport: tr, Timeout: c.EtcdHTTPClient.Timeout}
+	}
+	discovered := &topology{
+		directorName: director.Name,
+		director:     directorUUID,
+		deployment:   deployment,
+		job:          definition.JobName,
+		httpClient:   httpClient,
+	}
+	return discovered, discovery.BOSH{
+		Director:   boshClient,
+		Deployment: deployment,
+		Job:        definition.JobName,
+		Protocol:   etcdProtocol,
+		Port:       definition.Port,
+	}, nil
+}
+
+// endpointDiscoverer - the discoverer of a cluster found without BOSH, from its static list, DNS or the members its
+// seed endpoints list, reaching https endpoints with the configured certs
+func (cl *Cluster) endpointDiscoverer(definition ClusterConfig, probeTimeout time.Duration) (*topology, discovery.Discoverer, error) {
+	c := cl.controller
+	protocol := "http"
+	if *definition.SSLEnabled {
+		protocol = "https"
+	}
+
+	httpClient := c.EtcdHTTPClient
+	if definition.CACert != "" || definition.ClientCert != "" || *definition.SkipSSLVerification {
+		tr, err := tlsTransport(definition.CACert, definition.ClientCert, definition.ClientKey, *definition.SkipSSLVerification)
+		if err != nil {
+			return nil, nil, err
+		}
+		httpClient = &http.Client{Transport: tr, Timeout: c.EtcdHTTPClient.Timeout}
+	}
+
+	var discoverer discovery.Discoverer
+	switch definition.Discovery {
+	case discovery.ModeStatic:
+		discoverer = discovery.Static{Endpoints: definition.Endpoints, Protocol: protocol, Port: definition.Port}
+	case discovery.ModeDNS:
+		discoverer = discovery.DNS{Name: definition.DNSName, Protocol: protocol, Port: definition.Port, Resolver: c.Resolver}
+	case discovery.ModeDNSSRV:
+		discoverer = discovery.SRV{Domain: definition.DNSName, Resolver: c.Resolver}
+	case discovery.ModeMembers:
+		discoverer = discovery.Members{
+			Seeds:      definition.Endpoints,
+			Protocol:   protocol,
+			Port:       definition.Port,
+			API:        definition.EtcdAPI,
+			HTTPClient: httpClient,
+			Timeout:    probeTimeout,
+		}
+	default:
+		return nil, nil, fmt.Errorf("DISCOVERY must be one of %s, %s, %s, %s or %s, got %q", discovery.ModeBOSH, discovery.ModeStatic, discovery.ModeDNS, discovery.ModeDNSSRV, discovery.ModeMembers, definition.Discovery)
+	}
+	return &topology{httpClient: httpClient}, discoverer, nil
+}
+
+// InvalidateTopology - marks the cached etcd endpoints as out of date so the next check starts rediscovering them
+func (cl *Cluster) InvalidateTopology() {
+	cl.topologyMutex.Lock()
+	defer cl.topologyMutex.Unlock()
+
+	if cl.topology != nil {
+		cl.topology.invalid = true
+	}
+}
+
+// Rediscover - rediscovers the etcd VMs of every cluster from BOSH on demand and returns fresh reports, as served on /
+func (c *Controller) Rediscover(w http.ResponseWriter, r *http.Request) {
+	clusters := c.Clusters()
+	errs := eachCluster(clusters, func(i int, cluster *Cluster) error {
+		if err := cluster.Discover(); err != nil {
+			return err
+		}
+		_, err := cluster.Refresh()
+		return err
+	})
+	if len(clusters) > 1 {
+		c.CheckLeaders(w, r)
+		return
+	}
+	if errs[0] != nil {
+		errorPrint(errs[0], w)
+		return
+	}
+	report, _ := clusters[0].LastReport()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// currentTopology - returns the cluster's cached etcd endpoints, discovering them first when there are none. When
+// they were invalidated at least minInterval after the last discovery started, whether or not it succeeded, they are
+// rediscovered in the background, so
+// that a slow or stuck director does not hold up the probes, and the cached endpoints are returned along with the
+// error of the last failed rediscovery.
+func (cl *Cluster) currentTopology(minInterval time.Duration) (topology, error) {
+	cl.topologyMutex.Lock()
+	cached := cl.topology
+	if cached != nil {
+		defer cl.topologyMutex.Unlock()
+		if cached.invalid && time.Since(cl.attemptedAt) >= minInterval && !cl.rediscovering {
+			cl.rediscovering = true
+			go cl.rediscover()
+		}
+		return *cached, cl.rediscoverErr
+	}
+	cl.topologyMutex.Unlock()
+
+	if err := cl.Discover(); err != nil {
+		return topology{}, err
+	}
+
+	cl.topologyMutex.Lock()
+	defer cl.topologyMutex.Unlock()
+	return *cl.topology, nil
+}
+
+// rediscover - rediscovers the cluster's etcd endpoints in the background, recording why it failed for later checks
+func (cl *Cluster) rediscover() {
+	err := cl.Discover()
+	if err != nil {
+		fmt.Printf("Could not rediscover etcd endpoints of cluster %s, probing previous endpoints: %v\n", cl.Name, err)
+	}
+
+	cl.topologyMutex.Lock()
+	defer cl.topologyMutex.Unlock()
+	cl.rediscovering = false
+	cl.rediscoverErr = err
+}
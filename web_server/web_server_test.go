@@ -1,18 +1,27 @@
 package webServer_test
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"github.com/FidelityInternational/etcd-leader-monitor/alert"
+	"github.com/FidelityInternational/etcd-leader-monitor/health"
+	"github.com/FidelityInternational/etcd-leader-monitor/history"
+	"github.com/FidelityInternational/etcd-leader-monitor/store"
 	webs "github.com/FidelityInternational/etcd-leader-monitor/web_server"
 	"github.com/cloudfoundry-community/gogobosh"
 	"github.com/gorilla/mux"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"sync"
+	"time"
 )
 
 func Router(controller *webs.Controller) *mux.Router {
@@ -21,6 +30,30 @@ func Router(controller *webs.Controller) *mux.Router {
 	return r
 }
 
+// request - serves a GET of path through the controller's routes
+func request(controller *webs.Controller, path string) *httptest.ResponseRecorder {
+	mockRecorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+	Router(controller).ServeHTTP(mockRecorder, req)
+	return mockRecorder
+}
+
+// directedAt - points the top level BOSH settings, which describe the default director, at a fake director
+func directedAt(controller *webs.Controller, boshURL string) {
+	controller.Config.BoshURI = boshURL
+	controller.Config.BoshUsername = "example_user"
+	controller.Config.BoshPassword = "example_password"
+}
+
+// proxyTo - a transport that sends the requests for every etcd node to the one fake etcd server
+func proxyTo(etcdServer *httptest.Server) *http.Transport {
+	return &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(etcdServer.URL)
+		},
+	}
+}
+
 func init() {
 	var controller *webs.Controller
 	http.Handle("/", Router(controller))
@@ -423,11 +456,10 @@ jobs:
 				boshClient, _ := gogobosh.NewClient(boshConfig)
 				controller = webs.CreateController(boshClient, &http.Client{})
 				mockRecorder = httptest.NewRecorder()
-				os.Setenv("SSL_ENABLED", "true")
+				controller.Config.SSLEnabled = true
 			})
 
 			AfterEach(func() {
-				os.Unsetenv("SSL_ENABLED")
 				teardown()
 			})
 
@@ -485,7 +517,7 @@ jobs:
 				})
 			})
 
-			Context("when fetching leader stats returns an error", func() {
+			Context("when fetching leader stats returns an error for every node", func() {
 				BeforeEach(func() {
 					setupMultiple([]MockRoute{
 						{"GET", "/deployments", `[
@@ -535,6 +567,7 @@ jobs:
 					etcdHttpClient := &http.Client{Transport: etcdTransport}
 
 					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
 					mockRecorder = httptest.NewRecorder()
 				})
 
@@ -542,8 +575,17 @@ jobs:
 					teardown()
 				})
 
-				It("returns an error 500", func() {
-					Ω(mockRecorder.Code).Should(Equal(500))
+				It("reports every node as unreachable and quorum lost", func() {
+					Ω(mockRecorder.Code).Should(Equal(200))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeFalse())
+					Ω(report.Message).Should(Equal("Quorum lost"))
+					Ω(report.Nodes).Should(HaveLen(3))
+					for _, node := range report.Nodes {
+						Ω(node.Reachable).Should(BeFalse())
+						Ω(node.Error).ShouldNot(BeEmpty())
+					}
 				})
 			})
 
@@ -603,6 +645,7 @@ jobs:
 					etcdHttpClient := &http.Client{Transport: etcdTransport}
 
 					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
 					mockRecorder = httptest.NewRecorder()
 				})
 
@@ -612,7 +655,23 @@ jobs:
 
 				It("returns a suitable json response", func() {
 					Ω(mockRecorder.Code).Should(Equal(200))
-					Expect(mockRecorder.Body.String()).Should(Equal(`{"healthy": false, "message": "Incorrect number of followers"}`))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeFalse())
+					Ω(report.Message).Should(Equal("Incorrect number of followers"))
+					Ω(report.Problems).Should(ConsistOf(health.Problem{
+						Message: "Incorrect number of followers",
+						IP:      "30.30.30.30",
+						Detail:  "leader has 1 followers, expected 2",
+					}))
+					Ω(report.Nodes).Should(HaveLen(3))
+					Ω(report.Nodes[0].IP).Should(Equal("30.30.30.30"))
+					Ω(report.Nodes[0].JobName).Should(Equal("etcd_server-d284104a9345228c01e2"))
+					Ω(report.Nodes[0].VMCID).Should(Equal("11"))
+					Ω(report.Nodes[0].Leader).Should(BeTrue())
+					Ω(report.Nodes[0].Followers).Should(Equal(1))
+					Ω(report.Nodes[1].Index).Should(Equal(1))
+					Ω(report.Nodes[1].Leader).Should(BeFalse())
 				})
 			})
 
@@ -666,6 +725,7 @@ jobs:
 					etcdHttpClient := &http.Client{Transport: etcdTransport}
 
 					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
 					mockRecorder = httptest.NewRecorder()
 				})
 
@@ -675,7 +735,11 @@ jobs:
 
 				It("returns a suitable json response", func() {
 					Ω(mockRecorder.Code).Should(Equal(200))
-					Expect(mockRecorder.Body.String()).Should(Equal(`{"healthy": false, "message": "Too many leaders"}`))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeFalse())
+					Ω(report.Message).Should(Equal("Too many leaders"))
+					Ω(report.Nodes).Should(HaveLen(3))
 				})
 			})
 
@@ -729,6 +793,7 @@ jobs:
 					etcdHttpClient := &http.Client{Transport: etcdTransport}
 
 					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
 					mockRecorder = httptest.NewRecorder()
 				})
 
@@ -738,7 +803,181 @@ jobs:
 
 				It("returns a suitable json response", func() {
 					Ω(mockRecorder.Code).Should(Equal(200))
-					Expect(mockRecorder.Body.String()).Should(Equal(`{"healthy": false, "message": "Not enough leaders"}`))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeFalse())
+					Ω(report.Message).Should(Equal("Not enough leaders"))
+					Ω(report.Nodes).Should(HaveLen(3))
+				})
+			})
+
+			Context("when one etcd node does not answer before the probe timeout", func() {
+				var release chan struct{}
+
+				BeforeEach(func() {
+					setupMultiple([]MockRoute{
+						{"GET", "/deployments", `[
+   {
+      "name":"cf-12345",
+      "releases":[
+         {
+            "name":"example_release",
+            "version":"2"
+         }
+      ],
+      "stemcells":[
+         {
+            "name":"example_stemcell",
+            "version":"1"
+         }
+      ]
+   }
+]`, ""},
+						{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, fakeServer.URL + "/tasks/1"},
+						{"GET", "/tasks/1", `{"id":1,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+						{"GET", "/tasks/1/output", `{"vm_cid":"11","ips":["30.30.30.30"],"agent_id":"11","job_name":"etcd_server-d284104a9345228c01e2","index":0}
+{"vm_cid":"2","ips":["31.31.31.31"],"agent_id":"2","job_name":"etcd_server-d284104a9345228c01e2","index":1}
+{"vm_cid":"6","ips":["32.32.32.32"],"agent_id":"6","job_name":"etcd_server-d284104a9345228c01e2","index":2}`, ""},
+					}, "basic")
+
+					boshConfig := &gogobosh.Config{
+						Username:    "example_user",
+						Password:    "example_password",
+						BOSHAddress: fakeServer.URL,
+					}
+
+					boshClient, _ := gogobosh.NewClient(boshConfig)
+
+					release = make(chan struct{})
+					etcdServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if r.URL.String() == "http://32.32.32.32:4001/v2/stats/leader" {
+							<-release
+							return
+						}
+						if r.URL.String() == "http://30.30.30.30:4001/v2/stats/leader" {
+							w.WriteHeader(200)
+							w.Header().Set("Content-Type", "application/json")
+							fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{"a0294459200078aa":{},"b5c352b4495e4195":{}}}`)
+						} else {
+							w.WriteHeader(200)
+							w.Header().Set("Content-Type", "application/json")
+							fmt.Fprintln(w, `{"message":"not current leader"}`)
+						}
+					}))
+
+					etcdTransport := &http.Transport{
+						Proxy: func(req *http.Request) (*url.URL, error) {
+							return url.Parse(etcdServer.URL)
+						},
+						TLSClientConfig: &tls.Config{},
+					}
+					etcdHttpClient := &http.Client{Transport: etcdTransport}
+
+					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
+					mockRecorder = httptest.NewRecorder()
+					controller.Config.EtcdProbeTimeout = 100 * time.Millisecond
+				})
+
+				AfterEach(func() {
+					close(release)
+					teardown()
+				})
+
+				It("reports the slow node as timed out without failing the check", func() {
+					Ω(mockRecorder.Code).Should(Equal(200))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeFalse())
+					Ω(report.Message).Should(Equal("Node unreachable"))
+					Ω(report.Nodes[0].Reachable).Should(BeTrue())
+					Ω(report.Nodes[1].Reachable).Should(BeTrue())
+					Ω(report.Nodes[2].Reachable).Should(BeFalse())
+					Ω(report.Nodes[2].ErrorReason).Should(Equal("timeout"))
+				})
+			})
+
+			Context("when members disagree on which node is the leader", func() {
+				BeforeEach(func() {
+					setupMultiple([]MockRoute{
+						{"GET", "/deployments", `[
+   {
+      "name":"cf-12345",
+      "releases":[
+         {
+            "name":"example_release",
+            "version":"2"
+         }
+      ],
+      "stemcells":[
+         {
+            "name":"example_stemcell",
+            "version":"1"
+         }
+      ]
+   }
+]`, ""},
+						{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, fakeServer.URL + "/tasks/1"},
+						{"GET", "/tasks/1", `{"id":1,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+						{"GET", "/tasks/1/output", `{"vm_cid":"11","ips":["30.30.30.30"],"agent_id":"11","job_name":"etcd_server-d284104a9345228c01e2","index":0}
+{"vm_cid":"2","ips":["31.31.31.31"],"agent_id":"2","job_name":"etcd_server-d284104a9345228c01e2","index":1}
+{"vm_cid":"6","ips":["32.32.32.32"],"agent_id":"6","job_name":"etcd_server-d284104a9345228c01e2","index":2}`, ""},
+					}, "basic")
+
+					boshConfig := &gogobosh.Config{
+						Username:    "example_user",
+						Password:    "example_password",
+						BOSHAddress: fakeServer.URL,
+					}
+
+					boshClient, _ := gogobosh.NewClient(boshConfig)
+
+					etcdServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(200)
+						w.Header().Set("Content-Type", "application/json")
+						switch r.URL.String() {
+						case "http://30.30.30.30:4001/v2/stats/leader":
+							fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{"a0294459200078aa":{},"b5c352b4495e4195":{}}}`)
+						case "http://30.30.30.30:4001/v2/stats/self":
+							fmt.Fprintln(w, `{"name":"etcd-0","id":"6a0b69a54415a491","state":"StateLeader","leaderInfo":{"leader":"6a0b69a54415a491"}}`)
+						case "http://31.31.31.31:4001/v2/stats/self":
+							fmt.Fprintln(w, `{"name":"etcd-1","id":"a0294459200078aa","state":"StateFollower","leaderInfo":{"leader":"6a0b69a54415a491"}}`)
+						case "http://32.32.32.32:4001/v2/stats/self":
+							fmt.Fprintln(w, `{"name":"etcd-2","id":"b5c352b4495e4195","state":"StateCandidate","leaderInfo":{"leader":"b5c352b4495e4195"}}`)
+						default:
+							fmt.Fprintln(w, `{"message":"not current leader"}`)
+						}
+					}))
+
+					etcdTransport := &http.Transport{
+						Proxy: func(req *http.Request) (*url.URL, error) {
+							return url.Parse(etcdServer.URL)
+						},
+						TLSClientConfig: &tls.Config{},
+					}
+					etcdHttpClient := &http.Client{Transport: etcdTransport}
+
+					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
+					mockRecorder = httptest.NewRecorder()
+				})
+
+				AfterEach(func() {
+					teardown()
+				})
+
+				It("reports split brain with the groups of members", func() {
+					Ω(mockRecorder.Code).Should(Equal(200))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeFalse())
+					Ω(report.Message).Should(Equal("Split brain"))
+					Ω(report.LeaderGroups).Should(Equal([]health.LeaderGroup{
+						{LeaderID: "6a0b69a54415a491", Members: []string{"30.30.30.30", "31.31.31.31"}},
+						{LeaderID: "b5c352b4495e4195", Members: []string{"32.32.32.32"}},
+					}))
+					Ω(report.Nodes[2].Name).Should(Equal("etcd-2"))
+					Ω(report.Nodes[2].State).Should(Equal("StateCandidate"))
 				})
 			})
 
@@ -798,6 +1037,7 @@ jobs:
 					etcdHttpClient := &http.Client{Transport: etcdTransport}
 
 					controller = webs.CreateController(boshClient, etcdHttpClient)
+					directedAt(controller, fakeServer.URL)
 					mockRecorder = httptest.NewRecorder()
 				})
 
@@ -807,9 +1047,771 @@ jobs:
 
 				It("returns a suitable json response", func() {
 					Ω(mockRecorder.Code).Should(Equal(200))
-					Expect(mockRecorder.Body.String()).Should(Equal(`{"healthy": true, "message": "Everything is healthy"}`))
+					var report health.Report
+					Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+					Ω(report.Healthy).Should(BeTrue())
+					Ω(report.Message).Should(Equal("Everything is healthy"))
+					Ω(report.Nodes).Should(HaveLen(3))
+				})
+			})
+		})
+	})
+})
+
+var _ = Describe("Cached cluster state", func() {
+	var (
+		controller *webs.Controller
+		etcdServer *httptest.Server
+	)
+
+	cluster := func() *webs.Cluster {
+		return controller.Clusters()[0]
+	}
+
+	serve := func() health.Report {
+		var report health.Report
+		mockRecorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		Router(controller).ServeHTTP(mockRecorder, req)
+		Ω(mockRecorder.Code).Should(Equal(200))
+		Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+		return report
+	}
+
+	BeforeEach(func() {
+		setupMultiple([]MockRoute{
+			{"GET", "/deployments", `[{"name":"cf-12345","releases":[],"stemcells":[]}]`, ""},
+			{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/1", `{"id":1,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+			{"GET", "/tasks/1/output", `{"vm_cid":"11","ips":["30.30.30.30"],"agent_id":"11","job_name":"etcd_server-d284104a9345228c01e2","index":0}`, ""},
+		}, "basic")
+
+		boshClient, _ := gogobosh.NewClient(&gogobosh.Config{
+			Username:    "example_user",
+			Password:    "example_password",
+			BOSHAddress: fakeServer.URL,
+		})
+
+		etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(200)
+			fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{}}`)
+		}))
+		etcdTransport := proxyTo(etcdServer)
+		controller = webs.CreateController(boshClient, &http.Client{Transport: etcdTransport})
+		directedAt(controller, fakeServer.URL)
+	})
+
+	AfterEach(func() {
+		etcdServer.Close()
+		teardown()
+	})
+
+	Context("when no check has completed yet", func() {
+		It("checks the cluster on demand and caches the result", func() {
+			_, ok := cluster().LastReport()
+			Ω(ok).Should(BeFalse())
+			report := serve()
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.CheckedAt.IsZero()).Should(BeFalse())
+			cached, ok := cluster().LastReport()
+			Ω(ok).Should(BeTrue())
+			Ω(cached.CheckedAt).Should(Equal(report.CheckedAt))
+		})
+	})
+
+	Context("when the node only serves the v3 API", func() {
+		BeforeEach(func() {
+			etcdServer.Close()
+			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/version":
+					fmt.Fprintln(w, `{"etcdserver":"3.4.3","etcdcluster":"3.4.0"}`)
+				case "/v3/maintenance/status":
+					fmt.Fprintln(w, `{"header":{"member_id":"10276657743932975437","raft_term":"4"},"version":"3.4.3","dbSize":"24576","leader":"10276657743932975437","raftIndex":"31","raftTerm":"4"}`)
+				case "/v3/cluster/member/list":
+					fmt.Fprintln(w, `{"members":[{"ID":"10276657743932975437","name":"etcd-0","peerURLs":["http://30.30.30.30:2380"],"clientURLs":["http://30.30.30.30:2379"]}]}`)
+				default:
+					w.WriteHeader(404)
+				}
+			}))
+			controller.EtcdHTTPClient.Transport = proxyTo(etcdServer)
+		})
+
+		It("detects v3 from the version and probes the maintenance status", func() {
+			report := serve()
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Nodes[0].API).Should(Equal("v3"))
+			Ω(report.Nodes[0].ID).Should(Equal("8e9e05c52164694d"))
+			Ω(report.Nodes[0].Name).Should(Equal("etcd-0"))
+			Ω(report.Nodes[0].Leader).Should(BeTrue())
+			Ω(report.Nodes[0].RaftTerm).Should(Equal(uint64(4)))
+			Ω(report.Nodes[0].RaftIndex).Should(Equal(uint64(31)))
+			Ω(report.Nodes[0].DBSizeBytes).Should(Equal(uint64(24576)))
+		})
+
+		Context("and ETCD_API forces v2", func() {
+			BeforeEach(func() {
+				controller.Config.EtcdAPI = "v2"
+			})
+
+			It("probes the v2 endpoints the node does not serve", func() {
+				report := serve()
+				Ω(report.Healthy).Should(BeFalse())
+				Ω(report.Nodes[0].API).Should(Equal("v2"))
+				Ω(report.Nodes[0].Reachable).Should(BeFalse())
+			})
+		})
+
+		Context("and ETCD_API is not a supported value", func() {
+			BeforeEach(func() {
+				controller.Config.EtcdAPI = "v4"
+			})
+
+			It("fails the check", func() {
+				_, err := cluster().Refresh()
+				Ω(err).Should(MatchError(`ETCD_API must be one of v2, v3 or auto, got "v4"`))
+			})
+		})
+	})
+
+	Context("when the member list still holds a VM's old IP", func() {
+		BeforeEach(func() {
+			etcdServer.Close()
+			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+				switch r.URL.Path {
+				case "/v2/stats/leader":
+					fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{}}`)
+				case "/v2/stats/self":
+					fmt.Fprintln(w, `{"name":"etcd-0","id":"6a0b69a54415a491","state":"StateLeader","leaderInfo":{"leader":"6a0b69a54415a491"}}`)
+				case "/v2/members":
+					fmt.Fprintln(w, `{"members":[{"id":"6a0b69a54415a491","name":"etcd-0","peerURLs":["http://30.30.30.30:7001"],"clientURLs":["http://30.30.30.30:4001"]},{"id":"a0294459200078aa","name":"etcd-1","peerURLs":["http://29.29.29.29:7001"],"clientURLs":["http://29.29.29.29:4001"]}]}`)
+				}
+			}))
+			controller.EtcdHTTPClient.Transport = proxyTo(etcdServer)
+		})
+
+		It("reports the stale member alongside the membership", func() {
+			report := serve()
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal("Stale member"))
+			Ω(report.Members).Should(HaveLen(2))
+			Ω(report.Nodes[0].Members).Should(Equal(report.Members))
+			Ω(report.Problems).Should(ContainElement(health.Problem{
+				Message: "Stale member",
+				Detail:  "member a0294459200078aa (etcd-1) with peer URLs [http://29.29.29.29:7001] matches no VM",
+			}))
+		})
+	})
+
+	Context("when a check has completed", func() {
+		BeforeEach(func() {
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+		})
+
+		It("serves the cached report without contacting bosh or etcd", func() {
+			etcdServer.Close()
+			teardown()
+			report := serve()
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Stale).Should(BeFalse())
+			Ω(report.AgeSeconds).Should(BeNumerically(">=", 0))
+		})
+
+		It("keeps probing the discovered VMs without contacting bosh", func() {
+			teardown()
+			report, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.LastError).Should(BeEmpty())
+		})
+
+		Context("and a probe hits a node that no longer responds", func() {
+			BeforeEach(func() {
+				controller.Config.DiscoveryMinInterval = 0
+				etcdServer.Close()
+				_, err := cluster().Refresh()
+				Ω(err).Should(BeNil())
+			})
+
+			It("probes the previous VMs while rediscovering them from bosh in the background", func() {
+				before, _ := cluster().LastReport()
+				report, err := cluster().Refresh()
+				Ω(err).Should(BeNil())
+				Ω(report.DiscoveredAt).Should(Equal(before.DiscoveredAt))
+				Eventually(func() time.Time {
+					report, _ := cluster().Refresh()
+					return report.DiscoveredAt
+				}).Should(BeTemporally(">", before.DiscoveredAt))
+			})
+
+			It("does not wait for bosh to answer", func() {
+				blocked := make(chan struct{})
+				stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch r.URL.Path {
+					case "/info":
+						fmt.Fprintln(w, `{"name":"bosh","uuid":"2daf673a-9755-4b4f-aa6d-3632fbed8019","user_authentication":{"type":"basic"}}`)
+					case "/tasks":
+						fmt.Fprintln(w, `[]`)
+					default:
+						<-blocked
+					}
+				}))
+				defer stuck.Close()
+				defer close(blocked)
+				directedAt(controller, stuck.URL)
+
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					cluster().Refresh()
+				}()
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("does not retry a failed rediscovery until DISCOVERY_MIN_INTERVAL has passed", func() {
+				var mutex sync.Mutex
+				tasks := 0
+				failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch r.URL.Path {
+					case "/info":
+						fmt.Fprintln(w, `{"name":"bosh","uuid":"2daf673a-9755-4b4f-aa6d-3632fbed8019","user_authentication":{"type":"basic"}}`)
+					case "/tasks":
+						fmt.Fprintln(w, `[]`)
+					case "/deployments":
+						fmt.Fprintln(w, `[{"name":"cf-12345","releases":[],"stemcells":[]}]`)
+					default:
+						mutex.Lock()
+						tasks++
+						mutex.Unlock()
+						w.WriteHeader(500)
+					}
+				}))
+				defer failing.Close()
+				directedAt(controller, failing.URL)
+				controller.Config.DiscoveryMinInterval = 300 * time.Millisecond
+				requested := func() int {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return tasks
+				}
+
+				Eventually(func() string {
+					report, _ := cluster().Refresh()
+					return report.LastError
+				}, 2*time.Second).ShouldNot(BeEmpty())
+				Consistently(func() int {
+					cluster().Refresh()
+					return requested()
+				}, 100*time.Millisecond).Should(Equal(1))
+			})
+
+			It("probes the previous VMs and records the error when bosh is unreachable", func() {
+				teardown()
+				Eventually(func() string {
+					report, err := cluster().Refresh()
+					Ω(err).Should(BeNil())
+					Ω(report.Message).Should(Equal(health.MessageQuorumLost))
+					return report.LastError
+				}).ShouldNot(BeEmpty())
+			})
+		})
+
+		Context("when bosh is unreachable and nothing has been discovered", func() {
+			It("keeps the previous report and records the error", func() {
+				teardown()
+				fresh := webs.CreateController(controller.BoshClient, controller.EtcdHTTPClient)
+				fresh.Config = controller.Config
+				_, err := fresh.Clusters()[0].Refresh()
+				Ω(err).Should(HaveOccurred())
+				_, ok := fresh.Clusters()[0].LastReport()
+				Ω(ok).Should(BeFalse())
+			})
+		})
+
+		Context("and the report is older than STALE_AFTER", func() {
+			BeforeEach(func() {
+				controller.Config.StaleAfter = time.Nanosecond
+			})
+
+			It("flags the report as stale and unhealthy", func() {
+				report := serve()
+				Ω(report.Stale).Should(BeTrue())
+				Ω(report.Healthy).Should(BeFalse())
+				Ω(report.Message).Should(Equal(health.MessageStale))
+			})
+		})
+	})
+
+	Context("when bosh lists a VM without IPs while it is being recreated", func() {
+		BeforeEach(func() {
+			teardown()
+			setupMultiple([]MockRoute{
+				{"GET", "/deployments", `[{"name":"cf-12345","releases":[],"stemcells":[]}]`, ""},
+				{"GET", "/deployments/cf-12345/vms", `{"id":1,"state":"queued","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+				{"GET", "/tasks/1", `{"id":1,"state":"done","description":"retrieve vm-stats","timestamp":1460639781,"result":"","user":"example_user"}`, ""},
+				{"GET", "/tasks/1/output", `{"vm_cid":"11","ips":["30.30.30.30"],"agent_id":"11","job_name":"etcd_server-d284104a9345228c01e2","index":0}
+{"vm_cid":"12","ips":[],"agent_id":"12","job_name":"etcd_server-d284104a9345228c01e2","index":1}`, ""},
+			}, "basic")
+			directedAt(controller, fakeServer.URL)
+		})
+
+		It("probes the VMs that have IPs", func() {
+			report, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Nodes).Should(HaveLen(1))
+			Ω(report.Nodes[0].IP).Should(Equal("30.30.30.30"))
+		})
+	})
+
+	Describe("#Rediscover", func() {
+		It("rediscovers the VMs from bosh and returns a fresh report", func() {
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			before, _ := cluster().LastReport()
+
+			mockRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "http://example.com/discover", nil)
+			Router(controller).ServeHTTP(mockRecorder, req)
+			Ω(mockRecorder.Code).Should(Equal(200))
+			var report health.Report
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &report)).Should(Succeed())
+			Ω(report.DiscoveredAt.After(before.DiscoveredAt)).Should(BeTrue())
+			Ω(report.Nodes).Should(HaveLen(1))
+		})
+	})
+
+	Context("when a follower keeps failing between checks", func() {
+		var failures int
+
+		BeforeEach(func() {
+			failures = 100
+			etcdServer.Close()
+			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/stats/leader" {
+					w.WriteHeader(200)
+					fmt.Fprintln(w, `{"name":"etcd-0","id":"6a0b69a54415a491","state":"StateLeader","leaderInfo":{"leader":"6a0b69a54415a491"}}`)
+					return
+				}
+				failures += 20
+				w.WriteHeader(200)
+				fmt.Fprintf(w, `{"leader":"6a0b69a54415a491","followers":{"a0294459200078aa":{"latency":{"current":0.5},"counts":{"fail":%d,"success":10}}}}`, failures)
+			}))
+			controller.EtcdHTTPClient.Transport = proxyTo(etcdServer)
+		})
+
+		It("flags the follower as degraded once the failures since the last check exceed the threshold", func() {
+			first, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(first.Nodes[0].FollowerStats[0].FailCount).Should(BeEquivalentTo(120))
+			Ω(first.Nodes[0].FollowerStats[0].FailCountSinceCheck).Should(BeEquivalentTo(0))
+			Ω(first.Nodes[0].FollowerStats[0].Degraded).Should(BeFalse())
+
+			second, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(second.Nodes[0].FollowerStats[0].FailCountSinceCheck).Should(BeEquivalentTo(20))
+			Ω(second.Nodes[0].FollowerStats[0].Degraded).Should(BeTrue())
+			Ω(second.Problems).Should(ContainElement(health.Problem{
+				Message: health.MessageFollowerDegraded,
+				IP:      "30.30.30.30",
+				Detail:  "follower a0294459200078aa failed 20 times since the last check, more than 10",
+			}))
+		})
+	})
+
+	Describe("#ServeMetrics", func() {
+		It("exports the state of the cached report", func() {
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+
+			mockRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://example.com/metrics", nil)
+			Router(controller).ServeHTTP(mockRecorder, req)
+			Ω(mockRecorder.Code).Should(Equal(200))
+			Ω(mockRecorder.Body.String()).Should(ContainSubstring(`etcd_monitor_cluster_healthy{cluster="default"} 1` + "\n"))
+			Ω(mockRecorder.Body.String()).Should(ContainSubstring(`etcd_monitor_node_is_leader{cluster="default",ip="30.30.30.30",job="etcd_server-d284104a9345228c01e2",index="0"} 1`))
+			Ω(mockRecorder.Body.String()).Should(ContainSubstring(`etcd_monitor_discovery_duration_seconds_count{cluster="default",mode="bosh"} 1` + "\n"))
+		})
+	})
+
+	Describe("status codes", func() {
+
+		It("answers 200 whatever the verdict by default", func() {
+			etcdServer.Close()
+			Ω(request(controller, "/").Code).Should(Equal(200))
+		})
+
+		It("answers 200 when healthy and 503 when unhealthy with ?status=health", func() {
+			Ω(request(controller, "/?status=health").Code).Should(Equal(200))
+
+			etcdServer.Close()
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			response := request(controller, "/?status=health")
+			Ω(response.Code).Should(Equal(503))
+			var report health.Report
+			Ω(json.Unmarshal(response.Body.Bytes(), &report)).Should(Succeed())
+			Ω(report.Message).Should(Equal("Quorum lost"))
+		})
+
+		It("answers 502 with a json error when BOSH cannot be reached and STATUS_MODE is health", func() {
+			controller.Config.StatusMode = "health"
+			fakeServer.Close()
+			response := request(controller, "/")
+			Ω(response.Code).Should(Equal(502))
+			Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+			var body map[string]string
+			Ω(json.Unmarshal(response.Body.Bytes(), &body)).Should(Succeed())
+			Ω(body["error"]).ShouldNot(BeEmpty())
+		})
+
+		It("keeps the empty 500 when BOSH cannot be reached with ?status=legacy", func() {
+			controller.Config.StatusMode = "health"
+			fakeServer.Close()
+			response := request(controller, "/?status=legacy")
+			Ω(response.Code).Should(Equal(500))
+			Ω(response.Body.Len()).Should(Equal(0))
+		})
+
+		It("rejects an unknown mode", func() {
+			response := request(controller, "/?status=strict")
+			Ω(response.Code).Should(Equal(400))
+			Ω(response.Body.String()).Should(ContainSubstring(`status must be one of legacy or health, got \"strict\"`))
+		})
+	})
+
+	Describe("confirmed verdicts", func() {
+		It("only reports a problem as unhealthy once it persisted for CONFIRM_CHECKS checks", func() {
+			controller.Config.ConfirmChecks = 2
+			etcdServer.Close()
+
+			report, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.RawHealthy).Should(BeFalse())
+			Ω(report.RawMessage).Should(Equal("Quorum lost"))
+			Ω(report.UnhealthyChecks).Should(Equal(1))
+
+			report, err = cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal("Quorum lost"))
+		})
+
+		It("reports maintenance during a scheduled window", func() {
+			controller.Config.MaintenanceWindows = []string{"0 0 1 1 0 1h", "* * * * * 1h"}
+			etcdServer.Close()
+
+			report, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Healthy).Should(BeTrue())
+			Ω(report.Message).Should(Equal("Maintenance in progress"))
+			Ω(report.Maintenance).Should(Equal("scheduled window * * * * * 1h"))
+			Ω(report.RawMessage).Should(Equal("Quorum lost"))
+		})
+
+		Context("while BOSH updates the deployment", func() {
+			var tasks string
+
+			BeforeEach(func() {
+				tasks = `[{"id":42,"state":"processing","description":"create deployment","deployment":"cf-12345"}]`
+				serverMux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+					Ω(r.URL.Query().Get("deployment")).Should(Equal("cf-12345"))
+					fmt.Fprintln(w, tasks)
 				})
+				etcdServer.Close()
+			})
+
+			It("reports the deployment in progress rather than unhealthy", func() {
+				report, err := cluster().Refresh()
+				Ω(err).Should(BeNil())
+				Ω(report.Healthy).Should(BeTrue())
+				Ω(report.Updating).Should(BeTrue())
+				Ω(report.Message).Should(Equal("Deployment in progress"))
+				Ω(report.Maintenance).Should(Equal("BOSH task 42 (create deployment) is processing"))
+				Ω(report.RawMessage).Should(Equal("Quorum lost"))
+			})
+
+			It("keeps reporting the deployment in progress for the grace period after the task finishes", func() {
+				_, err := cluster().Refresh()
+				Ω(err).Should(BeNil())
+				tasks = `[]`
+
+				report, err := cluster().Refresh()
+				Ω(err).Should(BeNil())
+				Ω(report.Updating).Should(BeTrue())
+				Ω(report.Message).Should(Equal("Deployment in progress"))
+				Ω(report.Maintenance).Should(HavePrefix("BOSH finished updating"))
+
+				controller.Config.DeployGracePeriod = 0
+				report, err = cluster().Refresh()
+				Ω(err).Should(BeNil())
+				Ω(report.Updating).Should(BeFalse())
+				Ω(report.Healthy).Should(BeFalse())
+				Ω(report.Message).Should(Equal("Quorum lost"))
+			})
+		})
+	})
+
+	Describe("#ServeHistory", func() {
+		var term int
+
+		history := func() webs.History {
+			var timeline webs.History
+			mockRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://example.com/history", nil)
+			Router(controller).ServeHTTP(mockRecorder, req)
+			Ω(mockRecorder.Code).Should(Equal(200))
+			Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &timeline)).Should(Succeed())
+			return timeline
+		}
+
+		BeforeEach(func() {
+			term = 1
+			etcdServer.Close()
+			etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/keys/":
+					w.Header().Set("X-Raft-Term", fmt.Sprint(term))
+					term++
+				case "/v2/stats/self":
+					fmt.Fprintln(w, `{"name":"etcd-0","id":"6a0b69a54415a491","state":"StateLeader","leaderInfo":{"leader":"6a0b69a54415a491"}}`)
+				default:
+					fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{}}`)
+				}
+			}))
+			controller.EtcdHTTPClient.Transport = proxyTo(etcdServer)
+			controller.Config.FlappingElections = 2
+		})
+
+		It("returns the leader periods and every election", func() {
+			for i := 0; i < 3; i++ {
+				_, err := cluster().Refresh()
+				Ω(err).Should(BeNil())
+			}
+			timeline := history()
+			Ω(timeline.Periods).Should(HaveLen(3))
+			Ω(timeline.Periods[0].LeaderID).Should(Equal("6a0b69a54415a491"))
+			Ω(timeline.Periods[0].LeaderIP).Should(Equal("30.30.30.30"))
+			Ω(timeline.Changes).Should(HaveLen(2))
+			Ω(timeline.Changes[1].Term).Should(Equal(uint64(3)))
+			Ω(timeline.ElectionsInWindow).Should(Equal(2))
+			Ω(timeline.WindowSeconds).Should(Equal(float64(600)))
+		})
+
+		It("does not count an election when the same leader answers again after no node could be reached", func() {
+			stable := func() *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch r.URL.Path {
+					case "/v2/keys/":
+						w.Header().Set("X-Raft-Term", "7")
+					case "/v2/stats/self":
+						fmt.Fprintln(w, `{"name":"etcd-0","id":"6a0b69a54415a491","state":"StateLeader","leaderInfo":{"leader":"6a0b69a54415a491"}}`)
+					default:
+						fmt.Fprintln(w, `{"leader":"6a0b69a54415a491","followers":{}}`)
+					}
+				}))
+			}
+			etcdServer.Close()
+			etcdServer = stable()
+			controller.EtcdHTTPClient.Transport = proxyTo(etcdServer)
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+
+			etcdServer.Close()
+			report, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Message).Should(Equal(health.MessageQuorumLost))
+
+			etcdServer = stable()
+			controller.EtcdHTTPClient.Transport = proxyTo(etcdServer)
+			report, err = cluster().Refresh()
+			Ω(err).Should(BeNil())
+			Ω(report.Healthy).Should(BeTrue())
+
+			timeline := history()
+			Ω(timeline.Periods).Should(HaveLen(1))
+			Ω(timeline.Periods[0].LeaderID).Should(Equal("6a0b69a54415a491"))
+			Ω(timeline.Changes).Should(BeEmpty())
+			Ω(timeline.ElectionsInWindow).Should(Equal(0))
+		})
+
+		It("reports the leader as flapping once elections exceed FLAPPING_ELECTIONS", func() {
+			var report health.Report
+			for i := 0; i < 3; i++ {
+				var err error
+				report, err = cluster().Refresh()
+				Ω(err).Should(BeNil())
+				Ω(report.Healthy).Should(BeTrue())
+			}
+			report, _ = cluster().Refresh()
+			Ω(report.Healthy).Should(BeFalse())
+			Ω(report.Message).Should(Equal("Leader flapping"))
+			Ω(serve().Message).Should(Equal("Leader flapping"))
+		})
+	})
+
+	Describe("#ServeCheckHistory", func() {
+		var dir string
+
+		checks := func(query string) *httptest.ResponseRecorder {
+			mockRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://example.com/history/checks"+query, nil)
+			Router(controller).ServeHTTP(mockRecorder, req)
+			return mockRecorder
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "state")
+			Ω(err).Should(BeNil())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		Context("when no store is configured", func() {
+			It("returns a 404 explaining how to configure one", func() {
+				mockRecorder := checks("")
+				Ω(mockRecorder.Code).Should(Equal(404))
+				Ω(mockRecorder.Body.String()).Should(ContainSubstring("STORE_PATH"))
+			})
+		})
+
+		Context("when a store is configured", func() {
+			BeforeEach(func() {
+				fileStore, err := store.NewFileStore(dir, time.Hour)
+				Ω(err).Should(BeNil())
+				Ω(controller.UseStore(fileStore, time.Hour)).Should(Succeed())
+				_, err = cluster().Refresh()
+				Ω(err).Should(BeNil())
+			})
+
+			It("returns the stored checks", func() {
+				mockRecorder := checks("")
+				Ω(mockRecorder.Code).Should(Equal(200))
+				var stored []store.Check
+				Ω(json.Unmarshal(mockRecorder.Body.Bytes(), &stored)).Should(Succeed())
+				Ω(stored).Should(HaveLen(1))
+				Ω(stored[0].Healthy).Should(BeTrue())
+			})
+
+			It("returns only the checks after since", func() {
+				mockRecorder := checks("?since=" + time.Now().Add(time.Minute).Format(time.RFC3339))
+				Ω(mockRecorder.Code).Should(Equal(200))
+				Ω(mockRecorder.Body.String()).Should(Equal("[]\n"))
+			})
+
+			It("rejects a since that is not a time", func() {
+				Ω(checks("?since=yesterday").Code).Should(Equal(400))
+			})
+
+			It("restores the leadership timeline in a new controller", func() {
+				fileStore, err := store.NewFileStore(dir, time.Hour)
+				Ω(err).Should(BeNil())
+				Ω(fileStore.SaveChange(history.Change{At: time.Now(), FromLeaderID: "a", ToLeaderID: "b", Term: 2})).Should(Succeed())
+
+				restarted := webs.CreateController(nil, nil)
+				Ω(restarted.UseStore(fileStore, time.Hour)).Should(Succeed())
+				Ω(restarted.Clusters()[0].History.Periods()).Should(HaveLen(1))
+				Ω(restarted.Clusters()[0].History.Periods()[0].LeaderID).Should(Equal("b"))
 			})
 		})
 	})
+
+	Describe("#ConfigureAlerts", func() {
+		var (
+			receiver     *httptest.Server
+			received     chan alert.Transition
+			deployconfig webs.Config
+		)
+
+		BeforeEach(func() {
+			received = make(chan alert.Transition, 10)
+			receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var transition alert.Transition
+				Ω(json.NewDecoder(r.Body).Decode(&transition)).Should(Succeed())
+				received <- transition
+			}))
+			deployconfig = webs.DefaultConfig()
+			deployconfig.WebhookURLs = []string{receiver.URL + "/one", receiver.URL + "/two"}
+		})
+
+		AfterEach(func() {
+			receiver.Close()
+		})
+
+		It("does not alert when no webhooks are configured", func() {
+			controller.ConfigureAlerts(webs.Config{})
+			Ω(controller.Alerts).Should(BeNil())
+		})
+
+		It("posts to every webhook when the cluster becomes unhealthy", func() {
+			controller.ConfigureAlerts(deployconfig)
+
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			etcdServer.Close()
+			_, err = cluster().Refresh()
+			Ω(err).Should(BeNil())
+			controller.Alerts.Wait()
+
+			Ω(received).Should(HaveLen(2))
+			transition := <-received
+			Ω(transition.Kind).Should(Equal(alert.KindUnhealthy))
+			Ω(transition.Cluster).Should(Equal("default"))
+			Ω(transition.Report.Deployment).Should(Equal("cf-12345"))
+			Ω(transition.Report.Message).Should(Equal("Quorum lost"))
+			Ω(transition.Report.Nodes).Should(HaveLen(1))
+		})
+
+		It("opens a PagerDuty incident keyed by BOSH director, deployment and etcd job", func() {
+			events := make(chan alert.PagerDutyEvent, 10)
+			pagerDuty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var event alert.PagerDutyEvent
+				Ω(json.NewDecoder(r.Body).Decode(&event)).Should(Succeed())
+				events <- event
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer pagerDuty.Close()
+
+			deployconfig.WebhookURLs = nil
+			deployconfig.PagerDutyRoutingKeys = []string{"routing-key"}
+			deployconfig.PagerDutyEventsURL = pagerDuty.URL + "/v2/enqueue"
+			controller.ConfigureAlerts(deployconfig)
+
+			_, err := cluster().Refresh()
+			Ω(err).Should(BeNil())
+			etcdServer.Close()
+			_, err = cluster().Refresh()
+			Ω(err).Should(BeNil())
+			controller.Alerts.Wait()
+
+			Ω(events).Should(HaveLen(1))
+			event := <-events
+			Ω(event.RoutingKey).Should(Equal("routing-key"))
+			Ω(event.EventAction).Should(Equal("trigger"))
+			Ω(event.DedupKey).Should(Equal("etcd-leader-monitor/2daf673a-9755-4b4f-aa6d-3632fbed8019/cf-12345/etcd_server"))
+			Ω(event.Payload.Severity).Should(Equal("critical"))
+		})
+	})
+
+	Describe("#Poll", func() {
+		It("refreshes the cached report until cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				controller.Poll(ctx, 10*time.Millisecond)
+				close(done)
+			}()
+			Eventually(func() bool {
+				_, ok := cluster().LastReport()
+				return ok
+			}).Should(BeTrue())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+	})
 })